@@ -0,0 +1,29 @@
+package hastur
+
+// CounterAbsolute reports a monotonically increasing total, such as a count read from /proc or a database,
+// as a counter. The client remembers the last total for each name and sends the difference between it and
+// total. The first total for a name only sets the baseline, so nothing is sent. If total is less than the last
+// one, the source is assumed to have restarted from zero and total itself is sent.
+func (c *Client) CounterAbsolute(name string, total int64, opts ...Option) error {
+	c.totalsMutex.Lock()
+	last, seen := c.totals[name]
+	if c.totals == nil {
+		c.totals = make(map[string]int64)
+	}
+	c.totals[name] = total
+	c.totalsMutex.Unlock()
+	if !seen {
+		return nil
+	}
+	delta := total - last
+	if delta < 0 {
+		delta = total
+	}
+	return c.CounterInt64(name, delta, opts...)
+}
+
+// CounterAbsolute reports a monotonically increasing total as a counter using the default client. See
+// Client.CounterAbsolute.
+func CounterAbsolute(name string, total int64, opts ...Option) {
+	defaultClient.CounterAbsolute(name, total, opts...)
+}
@@ -0,0 +1,107 @@
+package hastur
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrAckUnsupported is returned by EventAck when the client's connection can't carry acknowledgements.
+var ErrAckUnsupported = errors.New("hastur: acknowledgements require a stream network")
+
+// ErrAckTimeout is returned by EventAck when no acknowledgement arrives in time.
+var ErrAckTimeout = errors.New("hastur: timed out waiting for event acknowledgement")
+
+// EventAck is the same as Event but waits up to timeout for the agent to acknowledge the event, returning
+// ErrAckTimeout if it doesn't. The agent acknowledges an event by writing a line such as
+//
+//	{"type":"ack","id":"<event id>"}
+//
+// back over the connection, so EventAck requires a stream network such as TCP (see SetNetwork) and otherwise
+// returns ErrAckUnsupported.
+func (c *Client) EventAck(name, subject, body string, attn []string, timeout time.Duration) error {
+	c.connMutex.RLock()
+	conn, supported := c.conn, c.isStream() && c.transport == nil
+	c.connMutex.RUnlock()
+	if !supported {
+		return ErrAckUnsupported
+	}
+	id := newEventID()
+	message, err := c.buildEvent(id, name, subject, body, attn, options{timestamp: c.clock.Now()})
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	acked := c.expectAck(id, conn)
+	defer c.forgetAck(id)
+	if err := c.send(message); err != nil {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		return nil
+	case <-timer.C:
+		return ErrAckTimeout
+	}
+}
+
+// Register interest in the acknowledgement of event id, making sure acknowledgements are being read from conn.
+// The returned channel is closed when the acknowledgement arrives. Registering the same id again returns the
+// same channel.
+func (c *Client) expectAck(id string, conn net.Conn) chan struct{} {
+	c.ackMutex.Lock()
+	defer c.ackMutex.Unlock()
+	if c.acks == nil {
+		c.acks = make(map[string]chan struct{})
+	}
+	acked, ok := c.acks[id]
+	if !ok {
+		acked = make(chan struct{})
+		c.acks[id] = acked
+	}
+	if conn != nil && conn != c.ackConn {
+		c.ackConn = conn
+		go c.readAcks(conn)
+	}
+	return acked
+}
+
+func (c *Client) forgetAck(id string) {
+	c.ackMutex.Lock()
+	defer c.ackMutex.Unlock()
+	delete(c.acks, id)
+}
+
+// Read acknowledgements from conn until it is closed.
+func (c *Client) readAcks(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var ack struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &ack) != nil || ack.Type != "ack" {
+			continue
+		}
+		c.ackMutex.Lock()
+		if acked, ok := c.acks[ack.ID]; ok {
+			close(acked)
+			delete(c.acks, ack.ID)
+		}
+		c.ackMutex.Unlock()
+	}
+	c.ackMutex.Lock()
+	defer c.ackMutex.Unlock()
+	if c.ackConn == conn {
+		c.ackConn = nil
+	}
+}
+
+// EventAck sends an event with the default client and waits for the agent to acknowledge it. See
+// Client.EventAck.
+func EventAck(name, subject, body string, attn []string, timeout time.Duration) error {
+	return defaultClient.EventAck(name, subject, body, attn, timeout)
+}
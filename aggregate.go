@@ -0,0 +1,54 @@
+package hastur
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// AggregatingCounter accumulates counter deltas in memory and sends their sum periodically as a single counter
+// message, which cuts message volume for counters incremented at high frequency. Create one with
+// AggregatedCounter. It is safe for concurrent use.
+type AggregatingCounter struct {
+	client  *Client
+	name    string
+	delta   atomic.Int64
+	stopper Stopper
+}
+
+// AggregatedCounter returns a counter named name whose deltas are summed in memory and sent every five
+// seconds. Call Stop when done with it to send any remainder and release its timer.
+func (c *Client) AggregatedCounter(name string) *AggregatingCounter {
+	counter := &AggregatingCounter{client: c, name: name}
+	duration := funcInterval("AggregatedCounter", FiveSecs)
+	counter.stopper = every(context.Background(), c, duration, false, func() { counter.Flush() })
+	return counter
+}
+
+// Add adds n to the accumulated delta. It does nothing while the client is disabled (see SetEnabled).
+func (a *AggregatingCounter) Add(n int) {
+	if !a.client.Enabled() {
+		return
+	}
+	a.delta.Add(int64(n))
+}
+
+// Flush sends the accumulated delta now, if it isn't zero, and resets it.
+func (a *AggregatingCounter) Flush() error {
+	delta := a.delta.Swap(0)
+	if delta == 0 {
+		return nil
+	}
+	return a.client.CounterInt64(a.name, delta)
+}
+
+// Stop halts the periodic sends and flushes the remaining delta.
+func (a *AggregatingCounter) Stop() error {
+	a.stopper.Stop()
+	return a.Flush()
+}
+
+// AggregatedCounter returns a counter whose deltas are summed and sent periodically by the default client. See
+// Client.AggregatedCounter.
+func AggregatedCounter(name string) *AggregatingCounter {
+	return defaultClient.AggregatedCounter(name)
+}
@@ -0,0 +1,131 @@
+package hastur
+
+import (
+	"errors"
+)
+
+// DefaultQueueSize is the number of messages the asynchronous send queue holds unless changed with
+// SetQueueSize.
+const DefaultQueueSize = 1024
+
+// ErrQueueFull is returned when a message is dropped because the asynchronous send queue is full.
+var ErrQueueFull = errors.New("hastur: send queue is full")
+
+// QueuePolicy specifies what happens to a message sent while the asynchronous send queue is full.
+type QueuePolicy int
+
+const (
+	// DropWhenFull discards the message and returns ErrQueueFull. This is the default.
+	DropWhenFull QueuePolicy = iota
+	// BlockWhenFull waits until the queue has room for the message.
+	BlockWhenFull
+)
+
+// flushMarker is placed on the queue by Flush; the worker closes it once every earlier message is written.
+type flushMarker chan struct{}
+
+// SetAsync turns asynchronous sending on or off. When enabled, messages are placed on a buffered queue and a
+// single background goroutine marshals them and writes them to the connection, so callers never wait on the
+// socket. Errors returned by the message methods then only reflect whether the message was queued. Turning
+// asynchronous sending off writes out any queued messages before returning.
+func (c *Client) SetAsync(enabled bool) {
+	c.asyncMutex.Lock()
+	defer c.asyncMutex.Unlock()
+	if enabled {
+		c.startQueue()
+	} else {
+		c.stopQueue()
+	}
+}
+
+// Async reports whether the client is sending asynchronously.
+func (c *Client) Async() bool {
+	c.asyncMutex.RLock()
+	defer c.asyncMutex.RUnlock()
+	return c.queue != nil
+}
+
+// SetQueueSize sets the number of messages the asynchronous send queue can hold. If the client is already
+// sending asynchronously, the current queue is written out and replaced by one of the new size.
+func (c *Client) SetQueueSize(size int) {
+	c.asyncMutex.Lock()
+	defer c.asyncMutex.Unlock()
+	c.queueSize = size
+	if c.queue != nil {
+		c.stopQueue()
+		c.startQueue()
+	}
+}
+
+// SetQueuePolicy sets the behavior when a message is sent while the asynchronous send queue is full.
+func (c *Client) SetQueuePolicy(policy QueuePolicy) {
+	c.asyncMutex.Lock()
+	defer c.asyncMutex.Unlock()
+	c.queuePolicy = policy
+}
+
+// Flush blocks until every message queued before the call has been written. It returns immediately if the
+// client is sending synchronously.
+func (c *Client) Flush() {
+	c.asyncMutex.RLock()
+	if c.queue == nil {
+		c.asyncMutex.RUnlock()
+		return
+	}
+	marker := make(flushMarker)
+	c.queue <- marker
+	c.asyncMutex.RUnlock()
+	<-marker
+}
+
+// Start the queue and its worker. The caller must hold asyncMutex for writing.
+func (c *Client) startQueue() {
+	if c.queue != nil {
+		return
+	}
+	c.queue = make(chan interface{}, c.queueSize)
+	c.workerDone = make(chan struct{})
+	go c.work(c.queue, c.workerDone)
+}
+
+// Close the queue and wait for the worker to write out the remaining messages. The caller must hold
+// asyncMutex for writing.
+func (c *Client) stopQueue() {
+	if c.queue == nil {
+		return
+	}
+	close(c.queue)
+	<-c.workerDone
+	c.queue = nil
+	c.workerDone = nil
+}
+
+func (c *Client) work(queue chan interface{}, done chan struct{}) {
+	defer close(done)
+	for message := range queue {
+		if marker, ok := message.(flushMarker); ok {
+			close(marker)
+			continue
+		}
+		if err := c.write(message); err != nil {
+			// Report the error from another goroutine so that a handler which sends messages (or flushes)
+			// cannot deadlock the worker.
+			go c.handleError(err, message)
+		}
+	}
+}
+
+// Place a message on the queue according to the queue policy. The caller must hold asyncMutex for reading.
+func (c *Client) enqueue(message interface{}) error {
+	select {
+	case c.queue <- message:
+		return nil
+	default:
+	}
+	if c.queuePolicy == DropWhenFull {
+		c.drop(DropQueueFull)
+		return ErrQueueFull
+	}
+	c.queue <- message
+	return nil
+}
@@ -0,0 +1,89 @@
+package hastur
+
+import (
+	"time"
+)
+
+// The *At methods send a message with an explicit timestamp and no labels besides the defaults, such as when
+// replaying metrics buffered during an outage with their original times. They are shorthand for the *Full
+// methods with nil labels, or for the short forms with WithTimestamp.
+
+// MarkAt is the same as Mark but with the given timestamp.
+func (c *Client) MarkAt(name, value string, timestamp time.Time) error {
+	return c.MarkFull(name, value, timestamp, nil)
+}
+
+// SetAt is the same as Set but with the given timestamp.
+func (c *Client) SetAt(name, value string, timestamp time.Time) error {
+	return c.SetFull(name, value, timestamp, nil)
+}
+
+// CounterAt is the same as Counter but with the given timestamp.
+func (c *Client) CounterAt(name string, value int, timestamp time.Time) error {
+	return c.CounterFull(name, value, timestamp, nil)
+}
+
+// GaugeAt is the same as Gauge but with the given timestamp.
+func (c *Client) GaugeAt(name string, value float64, timestamp time.Time) error {
+	return c.GaugeFull(name, value, timestamp, nil)
+}
+
+// TimerAt is the same as Timer but with the given timestamp.
+func (c *Client) TimerAt(name string, value float64, timestamp time.Time) error {
+	return c.TimerFull(name, value, timestamp, nil)
+}
+
+// CompoundAt is the same as Compound but with the given timestamp.
+func (c *Client) CompoundAt(name string, values map[string]float64, timestamp time.Time) error {
+	return c.CompoundFull(name, values, timestamp, nil)
+}
+
+// EventAt is the same as Event but with the given timestamp.
+func (c *Client) EventAt(name, subject, body string, attn []string, timestamp time.Time) error {
+	return c.EventFull(name, subject, body, attn, timestamp, nil)
+}
+
+// LogAt is the same as Log but with the given timestamp.
+func (c *Client) LogAt(subject string, data interface{}, timestamp time.Time) error {
+	return c.LogFull(subject, data, timestamp, nil)
+}
+
+// MarkAt sends a mark with the given timestamp using the default client.
+func MarkAt(name, value string, timestamp time.Time) {
+	defaultClient.MarkAt(name, value, timestamp)
+}
+
+// SetAt sends a set with the given timestamp using the default client.
+func SetAt(name, value string, timestamp time.Time) {
+	defaultClient.SetAt(name, value, timestamp)
+}
+
+// CounterAt sends a counter with the given timestamp using the default client.
+func CounterAt(name string, value int, timestamp time.Time) {
+	defaultClient.CounterAt(name, value, timestamp)
+}
+
+// GaugeAt sends a gauge with the given timestamp using the default client.
+func GaugeAt(name string, value float64, timestamp time.Time) {
+	defaultClient.GaugeAt(name, value, timestamp)
+}
+
+// TimerAt sends a timer with the given timestamp using the default client.
+func TimerAt(name string, value float64, timestamp time.Time) {
+	defaultClient.TimerAt(name, value, timestamp)
+}
+
+// CompoundAt sends a compound message with the given timestamp using the default client.
+func CompoundAt(name string, values map[string]float64, timestamp time.Time) {
+	defaultClient.CompoundAt(name, values, timestamp)
+}
+
+// EventAt sends an event with the given timestamp using the default client.
+func EventAt(name, subject, body string, attn []string, timestamp time.Time) {
+	defaultClient.EventAt(name, subject, body, attn, timestamp)
+}
+
+// LogAt sends a log line with the given timestamp using the default client.
+func LogAt(subject string, data interface{}, timestamp time.Time) {
+	defaultClient.LogAt(subject, data, timestamp)
+}
@@ -0,0 +1,101 @@
+package hastur
+
+import (
+	"errors"
+	"sort"
+)
+
+// GaugeBatch sends a gauge for each name and value in values, in order of name. The gauges share a single
+// timestamp, labels, and tags, given by opts. Failing to send one gauge doesn't prevent sending the rest; the
+// errors are combined. When sending asynchronously (see SetAsync), the gauges are queued together and flushed
+// once, so GaugeBatch returns after they have been written.
+func (c *Client) GaugeBatch(values map[string]float64, opts ...Option) error {
+	return sendBatch(c, "gauge", values, c.applyOptions(opts))
+}
+
+// CounterBatch sends a counter for each name and value in values, in order of name. The counters share a
+// single timestamp, labels, and tags, given by opts. Failing to send one counter doesn't prevent sending the
+// rest; the errors are combined. As with GaugeBatch, the counters are flushed once when sending asynchronously.
+func (c *Client) CounterBatch(values map[string]int, opts ...Option) error {
+	return sendBatch(c, "counter", values, c.applyOptions(opts))
+}
+
+// Build a message of messageType for each of values and send them together.
+func sendBatch[V int | float64](c *Client, messageType string, values map[string]V, o options) error {
+	var errs []error
+	messages := make([]interface{}, 0, len(values))
+	for _, key := range sortedKeys(values) {
+		name, err := c.metricName(messageType, key)
+		if err != nil {
+			errs = append(errs, ignoreDisabled(err))
+			continue
+		}
+		message := c.buildMessage(messageType, &statMessage[V]{Name: name, Value: values[key]}, o)
+		if messageType == "gauge" && !o.internal {
+			c.checkMonotonic(name, float64(values[key]), message)
+		}
+		messages = append(messages, message)
+	}
+	return errors.Join(append(errs, c.sendAll(messages)...)...)
+}
+
+// Send messages in order, as with send. When sending asynchronously, they are placed on the queue under a
+// single hold of asyncMutex, followed by one flush marker which is waited on. Failures are passed to the error
+// handler and returned.
+func (c *Client) sendAll(messages []interface{}) []error {
+	if len(messages) == 0 || c.disabled.Load() {
+		return nil
+	}
+	if c.draining.Load() {
+		for range messages {
+			c.drop(DropClosed)
+		}
+		return []error{ErrClosed}
+	}
+	for _, message := range messages {
+		c.publish(message)
+	}
+	errs := make([]error, len(messages))
+	c.asyncMutex.RLock()
+	if c.queue == nil {
+		c.asyncMutex.RUnlock()
+		for i, message := range messages {
+			errs[i] = c.write(message)
+		}
+	} else {
+		for i, message := range messages {
+			errs[i] = c.enqueue(message)
+		}
+		marker := make(flushMarker)
+		c.queue <- marker
+		c.asyncMutex.RUnlock()
+		<-marker
+	}
+	for i, err := range errs {
+		if err != nil {
+			c.handleError(err, messages[i])
+		}
+	}
+	return errs
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GaugeBatch sends a gauge for each name and value in values using the default client. See
+// Client.GaugeBatch.
+func GaugeBatch(values map[string]float64, opts ...Option) {
+	defaultClient.GaugeBatch(values, opts...)
+}
+
+// CounterBatch sends a counter for each name and value in values using the default client. See
+// Client.CounterBatch.
+func CounterBatch(values map[string]int, opts ...Option) {
+	defaultClient.CounterBatch(values, opts...)
+}
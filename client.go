@@ -0,0 +1,1136 @@
+package hastur
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned when sending a message with a Client that has been closed.
+var ErrClosed = errors.New("hastur: client is closed")
+
+// ErrNotConnected is returned when sending a message with a Client whose connection could not be dialed.
+var ErrNotConnected = errors.New("hastur: not connected")
+
+// Client publishes Hastur messages to a destination, which is reached over UDP by default (messages can be
+// mirrored to further destinations with AddDestination). Each Client has its own connection, app name, and
+// set of default labels, so several clients may be used independently from the same process.
+//
+// Unlike the package-level functions, each message method on a Client returns an error if the message could
+// not be marshalled or written to the connection.
+type Client struct {
+	// connMutex guards the destination and the connection. Sends hold it for reading while writing, so
+	// reconfiguring the destination waits for in-flight sends to complete.
+	connMutex  sync.RWMutex
+	network    string
+	udpAddress string
+	udpPort    int
+	socketPath string
+	conn       net.Conn
+	closed     bool
+	// Whether conn was supplied with SetConn, in which case the client never closes or replaces it itself, and
+	// the network it reports, which decides how messages are framed in place of network.
+	externalConn    bool
+	externalNetwork string
+	// Additional destinations added with AddDestination.
+	destinations []*destination
+	writeTimeout time.Duration
+	dialTimeout  time.Duration
+	tlsConfig    *tls.Config
+	// If set, messages are sent through transport instead of conn (see SetTransport).
+	transport  Transport
+	healthPort int
+	// Reconnection state (see SetReconnectBackoff), also guarded by connMutex.
+	broken         bool
+	nextReconnect  time.Time
+	reconnectDelay time.Duration
+	reconnectMin   time.Duration
+	reconnectMax   time.Duration
+
+	// asyncMutex guards the asynchronous send queue (see SetAsync). Enqueuing holds it for reading.
+	asyncMutex  sync.RWMutex
+	queue       chan interface{}
+	queueSize   int
+	queuePolicy QueuePolicy
+	workerDone  chan struct{}
+
+	// labelsMutex guards appName, defaultLabels, defaultTags, and contextLabels, which are read on every send.
+	// allDefaultLabels combines the builtin labels with defaultLabels; it is rebuilt whenever either changes
+	// and never modified afterward, so that sending only needs to copy from it. defaultTags is likewise
+	// replaced rather than modified. envAppName is HASTUR_APP_NAME as of the last SetAppName or ResetAppName.
+	labelsMutex      sync.RWMutex
+	appName          string
+	envAppName       string
+	defaultLabels    map[string]interface{}
+	allDefaultLabels map[string]interface{}
+	defaultTags      map[string]interface{}
+	contextLabels    []contextLabel
+
+	reportTimers atomic.Bool
+	disabled     atomic.Bool
+	draining     atomic.Bool
+	clock        clock
+
+	// rngMutex guards rng, which is used for sampling and created on first use.
+	rngMutex sync.Mutex
+	rng      *rand.Rand
+
+	// configMutex guards settings consulted when sending.
+	configMutex          sync.RWMutex
+	encoder              Encoder
+	compression          Compression
+	compressionThreshold int
+	prefix               string
+	prefixSeparator      string
+	strictNames          bool
+	strictLabels         bool
+	flattenLabels        bool
+	labelSeparator       string
+	maxEventSubjectLen   int
+	maxEventBodyLen      int
+	maxLogSubjectLen     int
+	eventAttempts        int
+	metricFilter         MetricFilter
+	labelMerge           LabelMergeStrategy
+	resolution           TimestampResolution
+	eventBackoff         time.Duration
+
+	drops [numDropReasons]atomic.Uint64
+
+	// rateMutex guards the rate limits (see SetRateLimit). rateLimited is set, under rateMutex, while there are
+	// any, so that sending needn't take the lock otherwise.
+	rateMutex       sync.Mutex
+	rateLimits      map[string]*bucket
+	globalRateLimit *bucket
+	rateLimited     atomic.Bool
+
+	// totalsMutex guards the last total sent for each counter by CounterAbsolute.
+	totalsMutex sync.Mutex
+	totals      map[string]int64
+
+	// gaugesMutex guards the gauge values tracked when gaugeMonotonicWarn is set (see SetGaugeMonotonicWarn).
+	gaugesMutex        sync.Mutex
+	gauges             map[string]*gaugeHistory
+	gaugeMonotonicWarn atomic.Bool
+
+	// ackMutex guards the acknowledgements awaited by EventAck, and the connection they are read from.
+	ackMutex sync.Mutex
+	acks     map[string]chan struct{}
+	ackConn  net.Conn
+
+	// outputMutex guards the writers which receive messages in dry-run mode and copies of messages (see
+	// SetDryRun and SetOutput).
+	outputMutex sync.Mutex
+	dryRun      io.Writer
+	output      io.Writer
+
+	// subscribersMutex guards the channels returned by Subscribe.
+	subscribersMutex sync.RWMutex
+	subscribers      []chan map[string]interface{}
+
+	errorHandler atomic.Pointer[ErrorHandler]
+	// handlersRunning is the number of calls to the error handler in progress, on any goroutine.
+	handlersRunning atomic.Int32
+
+	// Counters reported by Snapshot.
+	sent         atomic.Uint64
+	bytesWritten atomic.Uint64
+	reconnects   atomic.Uint64
+	skippedTicks atomic.Uint64
+	eventRetries atomic.Uint64
+	eventGiveUps atomic.Uint64
+	lastError    atomic.Pointer[error]
+}
+
+// NewClient creates a Client which publishes messages to the given UDP address and port. An error is returned
+// if the connection cannot be established.
+func NewClient(address string, port int) (*Client, error) {
+	return NewClientWithNetwork("udp", address, port)
+}
+
+// NewClientWithNetwork is the same as NewClient but dials the given network ("udp" or "tcp", or any of their
+// IPv4- and IPv6-only variants such as "tcp4") instead of always using UDP. On stream networks such as TCP,
+// each message is terminated by a newline so the agent can find message boundaries.
+func NewClientWithNetwork(network, address string, port int) (*Client, error) {
+	c, err := newClient(network, address, port)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Create a client and try to connect it. The client is returned even if the dial fails, in which case it
+// retries the dial when messages are sent.
+func newClient(network, address string, port int) (*Client, error) {
+	c := newUnconnectedClient(network, address, port)
+	return c, c.establishConn()
+}
+
+// Create a client without dialing.
+func newUnconnectedClient(network, address string, port int) *Client {
+	c := &Client{
+		network:              network,
+		udpAddress:           address,
+		udpPort:              port,
+		reconnectMin:         DefaultReconnectMin,
+		reconnectMax:         DefaultReconnectMax,
+		dialTimeout:          DefaultDialTimeout,
+		queueSize:            DefaultQueueSize,
+		defaultLabels:        make(map[string]interface{}),
+		defaultTags:          make(map[string]interface{}),
+		encoder:              JSONEncoder{},
+		clock:                realClock{},
+		compressionThreshold: DefaultCompressionThreshold,
+		prefixSeparator:      ".",
+		strictLabels:         true,
+		labelSeparator:       ".",
+		maxEventSubjectLen:   DefaultMaxEventSubjectLen,
+		maxEventBodyLen:      DefaultMaxEventBodyLen,
+		maxLogSubjectLen:     DefaultMaxLogSubjectLen,
+		envAppName:           os.Getenv("HASTUR_APP_NAME"),
+	}
+	c.rebuildDefaultLabelsLocked()
+	return c
+}
+
+// Close any existing connection and dial a new one. If the dial fails, the client is left without a connection
+// and the dial is retried on later sends (see SetReconnectBackoff). The caller must hold connMutex for writing
+// (or otherwise have exclusive access to the client).
+func (c *Client) establishConn() error {
+	c.releaseConn()
+	c.closed = false
+	c.broken = false
+	c.reconnectDelay = 0
+	conn, err := c.dial()
+	if err != nil {
+		c.broken = true
+		c.scheduleReconnect()
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// Dial the client's destination. The caller must hold connMutex.
+func (c *Client) dial() (net.Conn, error) {
+	if c.isUnix() {
+		return net.DialTimeout(c.network, c.socketPath, c.dialTimeout)
+	}
+	return c.dialAddress(net.JoinHostPort(c.udpAddress, strconv.Itoa(c.udpPort)))
+}
+
+// Dial address over the client's network, using TLS if it is configured and the network is TCP. The caller
+// must hold connMutex.
+func (c *Client) dialAddress(address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.dialTimeout}
+	if c.tlsConfig != nil && strings.HasPrefix(c.network, "tcp") {
+		return tls.DialWithDialer(dialer, c.network, address, c.tlsConfig)
+	}
+	return dialer.Dial(c.network, address)
+}
+
+// The network of the current connection: that of a connection supplied with SetConn, or else the network the
+// client dials. The caller must hold connMutex.
+func (c *Client) connNetwork() string {
+	if c.externalConn {
+		return c.externalNetwork
+	}
+	return c.network
+}
+
+// Whether the current connection is stream-oriented, requiring messages to be delimited.
+func (c *Client) isStream() bool {
+	network := c.connNetwork()
+	return !strings.HasPrefix(network, "udp") && network != "unixgram"
+}
+
+// Whether the client's network is a Unix domain socket rather than an address and port.
+func (c *Client) isUnix() bool {
+	return strings.HasPrefix(c.network, "unix")
+}
+
+// Close closes the client's UDP connection. Messages sent after the client is closed are discarded. Setting
+// a new address or port on a closed client opens a new connection. Calling Close more than once is harmless.
+//
+// If the client is sending asynchronously, Close first switches it back to synchronous mode, writing out any
+// queued messages.
+func (c *Client) Close() error {
+	c.SetAsync(false)
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.closeDestinations()
+	return c.releaseConn()
+}
+
+// Close the connection, unless it was supplied with SetConn, and forget it. The caller must hold connMutex for
+// writing.
+func (c *Client) releaseConn() error {
+	conn, external := c.conn, c.externalConn
+	c.conn, c.externalConn = nil, false
+	if conn == nil || external {
+		return nil
+	}
+	return conn.Close()
+}
+
+// Send an arbitrary message to the udp destination, either directly or via the asynchronous queue. Failures
+// are passed to the error handler.
+func (c *Client) send(message interface{}) error {
+	if c.disabled.Load() {
+		return nil
+	}
+	if c.draining.Load() {
+		c.drop(DropClosed)
+		return ErrClosed
+	}
+	c.publish(message)
+	c.asyncMutex.RLock()
+	if c.queue != nil {
+		err := c.enqueue(message)
+		c.asyncMutex.RUnlock()
+		if err != nil {
+			c.handleError(err, message)
+		}
+		return err
+	}
+	c.asyncMutex.RUnlock()
+	err := c.write(message)
+	if err != nil {
+		c.handleError(err, message)
+	}
+	return err
+}
+
+// Encode a message and write it to the connection. Marshalling failures are returned as a *MarshalError.
+func (c *Client) write(message interface{}) error {
+	bytes, err := c.currentEncoder().Marshal(message)
+	if err != nil {
+		c.drop(DropMarshalError)
+		return &MarshalError{Err: err}
+	}
+	if dryRun, err := c.writeLocal(bytes); dryRun {
+		return err
+	}
+	return c.writeBytes(c.compress(bytes))
+}
+
+// Write bytes to the connection and to any additional destinations, first re-dialing if a previous write
+// failed and the backoff has elapsed. A failure to write to one destination doesn't prevent writing to the
+// others; the errors are combined.
+func (c *Client) writeBytes(bytes []byte) error {
+	c.connMutex.RLock()
+	if c.broken && !c.closed && c.transport == nil && !c.externalConn && !time.Now().Before(c.nextReconnect) {
+		c.connMutex.RUnlock()
+		c.reconnect()
+		c.connMutex.RLock()
+	}
+	if c.closed {
+		c.connMutex.RUnlock()
+		c.drop(DropClosed)
+		return ErrClosed
+	}
+	if c.transport != nil {
+		return c.writeTransport(bytes)
+	}
+	if c.isStream() {
+		bytes = append(bytes, '\n')
+	} else if strings.HasPrefix(c.connNetwork(), "udp") && len(bytes) > maxDatagramSize {
+		c.connMutex.RUnlock()
+		c.drop(DropTooLarge)
+		return ErrMessageTooLarge
+	}
+	conn := c.conn
+	err := ErrNotConnected
+	if conn != nil {
+		c.setWriteDeadline(conn)
+		_, err = conn.Write(bytes)
+	}
+	recovered := err == nil && c.reconnectDelay != 0
+	destinationErrs := c.writeDestinations(bytes)
+	c.connMutex.RUnlock()
+
+	switch {
+	case conn == nil:
+		c.drop(DropNotConnected)
+	case err != nil:
+		c.drop(DropWriteError)
+		c.connFailed(conn)
+	case recovered:
+		c.connRecovered(conn)
+	}
+	if err == nil {
+		c.recordSent(len(bytes))
+	}
+	if len(destinationErrs) == 0 {
+		return err
+	}
+	return errors.Join(append([]error{err}, destinationErrs...)...)
+}
+
+// Send bytes through the transport and to each additional destination. The caller must hold connMutex for
+// reading; it is released before returning.
+func (c *Client) writeTransport(bytes []byte) error {
+	err := c.transport.Send(bytes)
+	destinationErrs := c.writeDestinations(bytes)
+	c.connMutex.RUnlock()
+	if err != nil {
+		c.drop(DropWriteError)
+	} else {
+		c.recordSent(len(bytes))
+	}
+	if len(destinationErrs) == 0 {
+		return err
+	}
+	return errors.Join(append([]error{err}, destinationErrs...)...)
+}
+
+// SetWriteTimeout bounds how long writing a message to the connection may take. A write which doesn't complete
+// in time fails and the message is counted as dropped (with DropWriteError), rather than blocking the caller.
+// A timeout of zero (the default) means writes never time out.
+func (c *Client) SetWriteTimeout(timeout time.Duration) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.writeTimeout = timeout
+	if timeout > 0 {
+		return
+	}
+	// Clear any deadline left over from an earlier write.
+	if c.conn != nil {
+		c.conn.SetWriteDeadline(time.Time{})
+	}
+	for _, d := range c.destinations {
+		d.conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// Set the deadline for the next write on conn, if there is a write timeout. The caller must hold connMutex.
+func (c *Client) setWriteDeadline(conn net.Conn) {
+	if c.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
+// Network returns the network the client dials ("udp" unless set otherwise).
+func (c *Client) Network() string {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.network
+}
+
+// SetNetwork sets the network the client dials (see NewClientWithNetwork), closing the previous connection and
+// dialing a new one.
+func (c *Client) SetNetwork(network string) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.network = network
+	return c.establishConn()
+}
+
+// SetUnixSocket switches the client to sending through the Unix domain datagram socket at path, overriding
+// the UDP address and port. This avoids the loopback network stack when the agent runs on the same host. If
+// the socket cannot be dialed (for instance, because path does not exist), an error is returned and the
+// client keeps using its current connection. Call SetNetwork("udp") to go back to UDP.
+func (c *Client) SetUnixSocket(path string) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	conn, err := net.DialTimeout("unixgram", path, c.dialTimeout)
+	if err != nil {
+		return err
+	}
+	c.releaseConn()
+	c.network = "unixgram"
+	c.socketPath = path
+	c.conn = conn
+	c.closed = false
+	c.broken = false
+	c.reconnectDelay = 0
+	return nil
+}
+
+// UnixSocket returns the path of the Unix domain socket set with SetUnixSocket, or "" if none was set.
+func (c *Client) UnixSocket() string {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.socketPath
+}
+
+// UdpAddress returns the client's target UDP address.
+func (c *Client) UdpAddress() string {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.udpAddress
+}
+
+// SetUdpAddress sets the client's target UDP address, which may be a hostname or an IPv4 or IPv6 address (such
+// as "::1", without brackets), closing the previous connection and dialing a new one. If the dial fails, the
+// error is returned and the dial is retried on later sends. This is safe to call while other goroutines are
+// sending; it waits for in-flight sends to finish.
+func (c *Client) SetUdpAddress(address string) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.udpAddress = address
+	return c.establishConn()
+}
+
+// UdpPort returns the client's target UDP port.
+func (c *Client) UdpPort() int {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.udpPort
+}
+
+// SetUdpPort sets the client's target UDP port, closing the previous connection and dialing a new one. If the
+// dial fails, the error is returned and the dial is retried on later sends. This is safe to call while other
+// goroutines are sending; it waits for in-flight sends to finish.
+func (c *Client) SetUdpPort(port int) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.udpPort = port
+	return c.establishConn()
+}
+
+// AddDefaultLabels adds label key/value pairs to the set of default labels to attach to every message. Labels
+// with the same keys given for a message take precedence over these (see SetLabelMergeStrategy).
+func (c *Client) AddDefaultLabels(labels map[string]interface{}) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	for label, value := range labels {
+		c.defaultLabels[label] = value
+	}
+	c.rebuildDefaultLabelsLocked()
+}
+
+// RemoveDefaultLabels removes default labels from the default label set that were previously added using
+// AddDefaultLabels. Provide labels to remove by key. This does not do anything if the labels given are not
+// present in the default label list. The builtin default labels ("app", "pid", and "host") cannot be removed,
+// although they may be overridden by adding a label with the same key; removing that label restores the
+// builtin value.
+func (c *Client) RemoveDefaultLabels(labels ...string) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	for _, label := range labels {
+		delete(c.defaultLabels, label)
+	}
+	c.rebuildDefaultLabelsLocked()
+}
+
+// DefaultLabels returns the current default labels which are attached to every Hastur message. This includes
+// the defaults ("app", "pid", and, if the hostname is known, "host") and any additional labels added with
+// AddDefaultLabels. The returned map is a copy and may be freely modified by the caller.
+func (c *Client) DefaultLabels() map[string]interface{} {
+	return copyMap(c.currentDefaultLabels())
+}
+
+// Return the combined default labels, which must not be modified.
+func (c *Client) currentDefaultLabels() map[string]interface{} {
+	c.labelsMutex.RLock()
+	defer c.labelsMutex.RUnlock()
+	return c.allDefaultLabels
+}
+
+// Recompute allDefaultLabels from the builtin labels and defaultLabels. The caller must hold labelsMutex for
+// writing (or otherwise have exclusive access to the client).
+func (c *Client) rebuildDefaultLabelsLocked() {
+	labels := make(map[string]interface{}, len(c.defaultLabels)+3)
+	labels["pid"] = pid
+	labels["app"] = c.appNameLocked()
+	if hostname != "" {
+		labels["host"] = hostname
+	}
+	for label, value := range c.defaultLabels {
+		labels[label] = value
+	}
+	c.allDefaultLabels = labels
+}
+
+// SetDefaultLabel adds a single label to the set of default labels to attach to every message.
+func (c *Client) SetDefaultLabel(key string, value interface{}) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	c.defaultLabels[key] = value
+	c.rebuildDefaultLabelsLocked()
+}
+
+// GetDefaultLabel returns the value of a single default label (including the builtin labels) and whether it is
+// present.
+func (c *Client) GetDefaultLabel(key string) (interface{}, bool) {
+	value, ok := c.currentDefaultLabels()[key]
+	return value, ok
+}
+
+// ClearDefaultLabels removes every default label added with AddDefaultLabels or SetDefaultLabel. The builtin
+// default labels remain.
+func (c *Client) ClearDefaultLabels() {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	c.defaultLabels = make(map[string]interface{})
+	c.rebuildDefaultLabelsLocked()
+}
+
+// Merge some extra labels with the default labels. The result must not be modified, since it is the shared
+// map of default labels when there are no extra labels.
+func (c *Client) mergeDefaultLabels(labels map[string]interface{}) map[string]interface{} {
+	c.configMutex.RLock()
+	strategy := c.labelMerge
+	c.configMutex.RUnlock()
+	if strategy == CallerOnly {
+		return copyMap(labels)
+	}
+	defaults := c.currentDefaultLabels()
+	if len(labels) == 0 {
+		return defaults
+	}
+	result := make(map[string]interface{}, len(labels)+len(defaults))
+	first, second := labels, defaults
+	if strategy == CallerWins {
+		first, second = defaults, labels
+	}
+	for label, value := range first {
+		result[label] = value
+	}
+	for label, value := range second {
+		result[label] = value
+	}
+	return result
+}
+
+// AppName returns the client's app name as a string. This is chosen, in priority order, from: (a) an app name
+// explicitly set with SetAppName, (b) the environment variable HASTUR_APP_NAME, or (c) the file name of the
+// currently running executable, without its directory. HASTUR_APP_NAME is read when the client is created and
+// again by SetAppName and ResetAppName, so later changes to it take effect only then. A default label named
+// "app" changes the label sent with messages, but not the app name.
+func (c *Client) AppName() string {
+	c.labelsMutex.RLock()
+	defer c.labelsMutex.RUnlock()
+	return c.appNameLocked()
+}
+
+// Compute the app name from appName and envAppName. The caller must hold labelsMutex.
+func (c *Client) appNameLocked() string {
+	if c.appName != "" {
+		return c.appName
+	}
+	if c.envAppName != "" {
+		return c.envAppName
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// SetAppName sets the app name that will be attached to each message under the "app" label. This overrides
+// all other sources of choosing an app name. Setting an empty name is the same as ResetAppName. It is safe to
+// call while other goroutines are sending: each message carries either the old name or the new one.
+func (c *Client) SetAppName(name string) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	c.appName = name
+	c.envAppName = os.Getenv("HASTUR_APP_NAME")
+	c.rebuildDefaultLabelsLocked()
+}
+
+// ResetAppName clears any app name set with SetAppName, so that AppName falls back to HASTUR_APP_NAME or the
+// executable name. HASTUR_APP_NAME is read again, so this also picks up changes made to it since the client
+// was created.
+func (c *Client) ResetAppName() {
+	c.SetAppName("")
+}
+
+// SetPrefix sets a prefix which is prepended, followed by the prefix separator, to the name of every mark,
+// counter, gauge, timer, compound, histogram, event, and heartbeat message. This namespaces all of a program's metrics
+// without repeating the prefix at each call site. An empty prefix (the default) leaves names unchanged.
+func (c *Client) SetPrefix(prefix string) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.prefix = prefix
+}
+
+// Prefix returns the prefix set with SetPrefix.
+func (c *Client) Prefix() string {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	return c.prefix
+}
+
+// SetPrefixSeparator sets the string placed between the prefix and the name (by default, ".").
+func (c *Client) SetPrefixSeparator(separator string) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.prefixSeparator = separator
+}
+
+// errDisabled is returned by metricName while the client is disabled. The message methods return nil in its
+// place (see ignoreDisabled), so that a disabled client neither sends nor reports anything.
+var errDisabled = errors.New("hastur: client is disabled")
+
+// Return err, unless it is errDisabled.
+func ignoreDisabled(err error) error {
+	if err == errDisabled {
+		return nil
+	}
+	return err
+}
+
+// Check that the client is enabled and that a message is admitted by the metric filter and the rate limits,
+// before it is built. Nothing is counted while the client is disabled. Unnamed messages, such as log lines,
+// pass an empty name, which skips the filter and is subject only to the global rate limit.
+func (c *Client) admit(messageType, name string) error {
+	if c.disabled.Load() {
+		return errDisabled
+	}
+	if name != "" && !c.filter(name, messageType) {
+		return ErrFiltered
+	}
+	if !c.allow(name) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Admit a named message (see admit), validate its name (see SetStrictNames), and apply the prefix, if any.
+func (c *Client) metricName(messageType, name string) (string, error) {
+	if err := c.admit(messageType, name); err != nil {
+		return "", err
+	}
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	if !validName(name) {
+		if c.strictNames {
+			c.drop(DropInvalidName)
+			return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+		name = sanitizeName(name)
+	}
+	if c.prefix == "" {
+		return name, nil
+	}
+	return c.prefix + c.prefixSeparator + name, nil
+}
+
+// TimeFull is the same as Time but allows for explicit setting of the timestamp and labels.
+func (c *Client) TimeFull(callback func(), name string, timestamp time.Time, labels map[string]interface{}) error {
+	start := c.clock.Now()
+	callback()
+	end := c.clock.Now()
+	return c.reportDuration(name, end.Sub(start), timestamp, labels)
+}
+
+// Time runs a function and reports its runtime to Hastur as a gauge (or a timer; see SetReportTimers).
+// callback is the function to run; name will be the name of the gauge message.
+func (c *Client) Time(callback func(), name string) error {
+	return c.TimeFull(callback, name, c.clock.Now(), make(map[string]interface{}))
+}
+
+// TimeErr is the same as Time but for a callback which may fail. The reported gauge carries an "error" label
+// which is true if callback returned an error and false otherwise. The callback's error is returned
+// unchanged; any error from sending the gauge is discarded.
+func (c *Client) TimeErr(callback func() error, name string) error {
+	start := c.clock.Now()
+	err := callback()
+	end := c.clock.Now()
+	c.reportDuration(name, end.Sub(start), c.clock.Now(), map[string]interface{}{"error": err != nil})
+	return err
+}
+
+// TimeCurrent provides a convenient way to measure the time until the current function returns and report it
+// to Hastur as a gauge (or a timer; see SetReportTimers). name is the name of the gauge and start is the
+// starting time for measurement (generally time.Now()). This should be called using defer.
+func (c *Client) TimeCurrent(name string, start time.Time) error {
+	return c.TimeCurrentFull(name, start, make(map[string]interface{}))
+}
+
+// TimeCurrentFull is the same as TimeCurrent but attaches labels to the reported gauge. When called with defer,
+// the labels are evaluated at the defer statement, not when the function returns.
+func (c *Client) TimeCurrentFull(name string, start time.Time, labels map[string]interface{}) error {
+	end := c.clock.Now()
+	return c.reportDuration(name, end.Sub(start), end, labels)
+}
+
+// SetReportTimers controls whether Time, TimeFull, and TimeCurrent report durations as timer messages rather
+// than gauges. Durations are sent in seconds either way.
+func (c *Client) SetReportTimers(enabled bool) {
+	c.reportTimers.Store(enabled)
+}
+
+// Send a measured duration as a gauge or timer, according to SetReportTimers.
+func (c *Client) reportDuration(name string, duration time.Duration, timestamp time.Time,
+	labels map[string]interface{}) error {
+	if c.reportTimers.Load() {
+		return c.TimerFull(name, duration.Seconds(), timestamp, labels)
+	}
+	return c.GaugeFull(name, duration.Seconds(), timestamp, labels)
+}
+
+// Fill in the type, timestamp, labels, and tags (each merged with its defaults) of a message from o. Every
+// message is built here, so fields common to all messages are handled alike. A zero timestamp, which would
+// otherwise be sent as a large negative number, means the current time.
+func (c *Client) buildMessage(messageType string, m message, o options) message {
+	timestamp := o.timestamp
+	if timestamp.IsZero() {
+		timestamp = c.clock.Now()
+	}
+	m.setHeader(messageType, convertTime(timestamp, c.TimestampResolution()),
+		c.checkLabels(c.flatten(c.mergeDefaultLabels(o.labels))), c.mergeDefaultTags(o.tags))
+	if c.inErrorHandler() {
+		m.markSentByHandler()
+	}
+	return m
+}
+
+// MarkFull is the same as Mark but allows for explicit setting of the timestamp and labels. The value may be
+// anything which can be marshalled, as with MarkData.
+func (c *Client) MarkFull(name string, value interface{}, timestamp time.Time, labels map[string]interface{}) error {
+	return c.mark(name, value, fullOptions(timestamp, labels))
+}
+
+func (c *Client) mark(name string, value interface{}, o options) error {
+	name, err := c.metricName("mark", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage("mark", &statMessage[interface{}]{Name: name, Value: value}, o))
+}
+
+// Mark sends a 'mark' stat to Hastur. A mark gives the time that an interesting event occurred even with no
+// value attached. You can also use a mark to send back string-valued stats that might otherwise be gauges --
+// "Green", "Yellow", "Red" or similar (see StatusMark).
+//
+// A mark is different from a Hastur event because it happens at stat priority -- it can be batched or
+// slightly delayed, and doesn't have an end-to-end acknowledgement included.
+func (c *Client) Mark(name, value string, opts ...Option) error {
+	return c.mark(name, value, c.applyOptions(opts))
+}
+
+// MarkData is the same as Mark but attaches a structured value, such as a status object, instead of a string.
+// The value must be something the client's encoder can marshal.
+func (c *Client) MarkData(name string, value interface{}, opts ...Option) error {
+	return c.mark(name, value, c.applyOptions(opts))
+}
+
+// SetFull is the same as Set but allows for explicit setting of the timestamp and labels.
+func (c *Client) SetFull(name, value string, timestamp time.Time, labels map[string]interface{}) error {
+	return c.set(name, value, fullOptions(timestamp, labels))
+}
+
+func (c *Client) set(name, value string, o options) error {
+	name, err := c.metricName("set", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage("set", &statMessage[string]{Name: name, Value: value}, o))
+}
+
+// Set sends a 'set' stat to Hastur. A set counts the distinct values seen for a name over each interval, such
+// as the number of unique users per minute; value identifies the member (a user ID, say).
+func (c *Client) Set(name, value string, opts ...Option) error {
+	return c.set(name, value, c.applyOptions(opts))
+}
+
+// CounterFull is the same as Counter but allows for explicit setting of the timestamp and labels.
+func (c *Client) CounterFull(name string, value int, timestamp time.Time, labels map[string]interface{}) error {
+	return counterFull(c, name, value, fullOptions(timestamp, labels))
+}
+
+// CounterInt64Full is the same as CounterInt64 but allows for explicit setting of the timestamp and labels.
+func (c *Client) CounterInt64Full(name string, value int64, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return counterFull(c, name, value, fullOptions(timestamp, labels))
+}
+
+// CounterInt64 is the same as Counter but takes a 64-bit delta, for counters such as byte counts whose deltas
+// may not fit in an int on 32-bit platforms.
+func (c *Client) CounterInt64(name string, value int64, opts ...Option) error {
+	return counterFull(c, name, value, c.applyOptions(opts))
+}
+
+// CounterFloatFull is the same as CounterFloat but allows for explicit setting of the timestamp and labels.
+func (c *Client) CounterFloatFull(name string, value float64, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return counterFull(c, name, value, fullOptions(timestamp, labels))
+}
+
+// CounterFloat is the same as Counter but takes a fractional delta, for counters such as accumulated seconds of
+// work.
+func (c *Client) CounterFloat(name string, value float64, opts ...Option) error {
+	return counterFull(c, name, value, c.applyOptions(opts))
+}
+
+func counterFull[V int | int64 | float64](c *Client, name string, value V, o options) error {
+	name, err := c.metricName("counter", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage("counter", &statMessage[V]{Name: name, Value: value}, o))
+}
+
+// Counter sends a 'counter' stat to Hastur. Counters are linear, and are sent as deltas (differences).
+// Sending a value of 1 adds 1 to the counter.
+func (c *Client) Counter(name string, value int, opts ...Option) error {
+	return counterFull(c, name, value, c.applyOptions(opts))
+}
+
+// Increment adds 1 to a counter. It is the same as Counter(name, 1).
+func (c *Client) Increment(name string, opts ...Option) error {
+	return c.Counter(name, 1, opts...)
+}
+
+// Decrement subtracts 1 from a counter. It is the same as Counter(name, -1).
+func (c *Client) Decrement(name string, opts ...Option) error {
+	return c.Counter(name, -1, opts...)
+}
+
+// GaugeFull is the same as Gauge but allows for explicit setting of the timestamp and labels.
+func (c *Client) GaugeFull(name string, value float64, timestamp time.Time, labels map[string]interface{}) error {
+	return gaugeFull(c, name, value, fullOptions(timestamp, labels))
+}
+
+// Gauge sends a 'gauge' stat to Hastur. A gauge's value may or may not be on a linear scale. It is sent as an
+// exact value, not a difference.
+func (c *Client) Gauge(name string, value float64, opts ...Option) error {
+	return gaugeFull(c, name, value, c.applyOptions(opts))
+}
+
+// GaugeIntFull is the same as GaugeInt but allows for explicit setting of the timestamp and labels.
+func (c *Client) GaugeIntFull(name string, value int, timestamp time.Time, labels map[string]interface{}) error {
+	return gaugeFull(c, name, value, fullOptions(timestamp, labels))
+}
+
+// GaugeInt is the same as Gauge but for an integer value, such as a queue depth, which is sent as an integer
+// rather than a float.
+func (c *Client) GaugeInt(name string, value int, opts ...Option) error {
+	return gaugeFull(c, name, value, c.applyOptions(opts))
+}
+
+func gaugeFull[V int | float64](c *Client, name string, value V, o options) error {
+	name, err := c.metricName("gauge", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	message := c.buildMessage("gauge", &statMessage[V]{Name: name, Value: value}, o)
+	if !o.internal {
+		c.checkMonotonic(name, float64(value), message)
+	}
+	return c.send(message)
+}
+
+// TimerFull is the same as Timer but allows for explicit setting of the timestamp and labels.
+func (c *Client) TimerFull(name string, value float64, timestamp time.Time, labels map[string]interface{}) error {
+	return c.timer(name, value, fullOptions(timestamp, labels))
+}
+
+func (c *Client) timer(name string, value float64, o options) error {
+	name, err := c.metricName("timer", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage("timer", &statMessage[float64]{Name: name, Value: value}, o))
+}
+
+// Timer sends a 'timer' stat to Hastur. A timer records the duration of an operation, in seconds. Unlike a
+// gauge, the agent treats the values of a timer as samples of a distribution and may compute percentiles
+// over them.
+func (c *Client) Timer(name string, value float64, opts ...Option) error {
+	return c.timer(name, value, c.applyOptions(opts))
+}
+
+// CompoundFull is the same as Compound but allows for explicit setting of the timestamp and labels.
+func (c *Client) CompoundFull(name string, values map[string]float64, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.compound(name, values, fullOptions(timestamp, labels))
+}
+
+func (c *Client) compound(name string, values map[string]float64, o options) error {
+	name, err := c.metricName("compound", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	copied := make(map[string]float64, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return c.send(c.buildMessage("compound", &compoundMessage{Name: name, Values: copied}, o))
+}
+
+// Compound sends several related stats, such as the count, sum, minimum, and maximum of a batch, as a single
+// 'compound' message with the values keyed by their names. This uses one message instead of one per stat and
+// tells the agent the stats belong together; the agent may break it apart.
+func (c *Client) Compound(name string, values map[string]float64, opts ...Option) error {
+	return c.compound(name, values, c.applyOptions(opts))
+}
+
+// EventFull is the same as Event but allows for explicit setting of the timestamp and labels.
+func (c *Client) EventFull(name, subject, body string, attn []string, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.eventFull(newEventID(), name, subject, body, attn, fullOptions(timestamp, labels))
+}
+
+// Send an event with the given ID, retrying it if enabled (see SetEventRetry).
+func (c *Client) eventFull(id, name, subject, body string, attn []string, o options) error {
+	message, err := c.buildEvent(id, name, subject, body, attn, o)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.sendEvent(id, message)
+}
+
+func (c *Client) buildEvent(id, name, subject, body string, attn []string, o options) (message, error) {
+	name, err := c.metricName("event", name)
+	if err != nil {
+		return nil, err
+	}
+	c.configMutex.RLock()
+	maxSubjectLen, maxBodyLen := c.maxEventSubjectLen, c.maxEventBodyLen
+	c.configMutex.RUnlock()
+	return c.buildMessage("event", &eventMessage{
+		ID:      id,
+		Name:    name,
+		Subject: truncate(subject, maxSubjectLen),
+		Body:    truncate(body, maxBodyLen),
+		Attn:    attn,
+	}, o), nil
+}
+
+// Event sends an event to Hastur. An event is high-priority and never buffered, and will be sent
+// preferentially to stats or heartbeats. It includes an end-to-end acknowledgement mechanism to ensure
+// arrival (see EventAck and SetEventRetry), but is expensive to store, send and query.
+//
+// 'attn' is a mechanism to describe the system or component in which the event occurs and who would care
+// about it. Obvious values to include in the array include user logins, email addresses, team names, and
+// server, library or component names. This allows making searches like "what events should I worry about?".
+//
+// The name is the name of the event (e.g., "bad.log.line"). The subject is a subject or message for this
+// specific event. The body can contain additional details -- this could be a stack trace or an email body.
+// "attn" are relevant components or teams. Web hooks or email addresses would go here.
+func (c *Client) Event(name, subject, body string, attn []string, opts ...Option) error {
+	return c.eventFull(newEventID(), name, subject, body, attn, c.applyOptions(opts))
+}
+
+// LogFull is the same as Log but allows for explicit setting of the timestamp and labels.
+func (c *Client) LogFull(subject string, data interface{}, timestamp time.Time, labels map[string]interface{}) error {
+	return c.log(subject, data, fullOptions(timestamp, labels))
+}
+
+func (c *Client) log(subject string, data interface{}, o options) error {
+	if err := c.admit("log", ""); err != nil {
+		return ignoreDisabled(err)
+	}
+	c.configMutex.RLock()
+	maxSubjectLen := c.maxLogSubjectLen
+	c.configMutex.RUnlock()
+	return c.send(c.buildMessage("log", &logMessage{Subject: truncate(subject, maxSubjectLen), Data: data}, o))
+}
+
+// Log sends a log line to Hastur. A log line is of relatively low priority, comparable to stats, and is
+// allowed to be buffered or batched while higher-priority data is sent first.
+//
+// The data values must be convertable to json. Severity can be included in the data field with the tag
+// "severity", if desired; LogLevel does this consistently.
+func (c *Client) Log(subject string, data interface{}, opts ...Option) error {
+	return c.log(subject, data, c.applyOptions(opts))
+}
+
+// RegisterProcess sends a process registration to Hastur. This indicates that the process is currently
+// running, and that heartbeats should be sent for some time afterward.
+//
+// The name parameter indicates the name of the app or process, while data is any additional information to
+// include with the registration. The values of data must be convertable to json. Besides the name, the
+// registration describes the process with "language", "version" (of this library), "go_version", "num_cpu",
+// and "start_time" (in the format of message timestamps); data may override any of these.
+func (c *Client) RegisterProcess(name string, data map[string]interface{}, timestamp time.Time,
+	labels map[string]interface{}) error {
+	if err := c.admit("reg_process", ""); err != nil {
+		return ignoreDisabled(err)
+	}
+	allData := map[string]interface{}{
+		"name":       name,
+		"language":   "go",
+		"version":    Version,
+		"go_version": runtime.Version(),
+		"num_cpu":    runtime.NumCPU(),
+		"start_time": convertTime(processStart, c.TimestampResolution()),
+	}
+	for key, value := range data {
+		allData[key] = value
+	}
+	message := c.buildMessage("reg_process", &registrationMessage{Data: allData}, fullOptions(timestamp, labels))
+	return c.send(message)
+}
+
+// InfoProcessFull is the same as InfoProcess but allows for explicit setting of the timestamp and labels.
+func (c *Client) InfoProcessFull(tag string, data map[string]interface{}, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.info("info_process", tag, data, fullOptions(timestamp, labels))
+}
+
+// Send process or agent information, according to messageType.
+func (c *Client) info(messageType, tag string, data map[string]interface{}, o options) error {
+	if err := c.admit(messageType, ""); err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage(messageType, &infoMessage{Tag: tag, Data: data}, o))
+}
+
+// InfoProcess sends freeform process information to Hastur. This can be supplemental information about
+// resources like memory, files open and whatnot. It can be additional configuration or deployment information
+// like environment (dev/staging/prod), software or component version, etc. It can be information about the
+// application as deployed, as run, or as it is currently running.
+//
+// The default labels contain application name and process ID to match this information with the process
+// registration and similar details.
+//
+// Any number of these can be sent as information changes or is superceded. However, if information changes
+// constantly or needs to be graphed or alerted on, send that separately as a metric or event. These messages
+// are freeform and not readily separable or graphable.
+func (c *Client) InfoProcess(tag string, data map[string]interface{}, opts ...Option) error {
+	return c.info("info_process", tag, data, c.applyOptions(opts))
+}
+
+// InfoAgentFull is the same as InfoAgent but allows for explicit setting of the timestamp and labels.
+func (c *Client) InfoAgentFull(tag string, data map[string]interface{}, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.info("info_agent", tag, data, fullOptions(timestamp, labels))
+}
+
+// InfoAgent sends back freeform data about the agent or host that Hastur is running on. Sample uses include
+// what libraries or packages are installed and available, or the total installed memory.
+//
+// Any number of these can be sent as information changes or is superceded. However, if information changes
+// constantly or needs to be graphed or alerted on, send that separately as a metric or event. These messages
+// are freeform and not readily separable or graphable.
+func (c *Client) InfoAgent(tag string, data map[string]interface{}, opts ...Option) error {
+	return c.info("info_agent", tag, data, c.applyOptions(opts))
+}
+
+// HeartbeatFull is the same as Heartbeat but allows for explicit setting of the timestamp and labels.
+func (c *Client) HeartbeatFull(name string, value, timeout float64, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.heartbeat(name, value, timeout, fullOptions(timestamp, labels))
+}
+
+func (c *Client) heartbeat(name string, value, timeout float64, o options) error {
+	name, err := c.metricName("hb_process", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	return c.send(c.buildMessage("hb_process", &heartbeatMessage{Name: name, Value: value, Timeout: timeout}, o))
+}
+
+// Heartbeat sends a heartbeat to Hastur. A heartbeat is a periodic message which indicates that a host,
+// application or service is currently running. It is higher priority than a statistic and should not be
+// batched, but is lower priority than an event and does not include an end-to-end acknowledgement.
+func (c *Client) Heartbeat(opts ...Option) error {
+	return c.heartbeat("application.heartbeat", 0, 0, c.applyOptions(opts))
+}
@@ -0,0 +1,81 @@
+package hastur
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+)
+
+// Compression specifies how large messages are compressed before being written (see SetCompression).
+type Compression int
+
+const (
+	// NoCompression sends every message as-is. This is the default.
+	NoCompression Compression = iota
+	// Gzip compresses large messages with gzip. Compressed messages are prefixed with GzipMarker.
+	Gzip
+	// Deflate compresses large messages with raw deflate. Compressed messages are prefixed with DeflateMarker.
+	Deflate
+)
+
+// Marker bytes prefixed to compressed messages. An encoded message never begins with either byte, so the
+// agent can distinguish compressed messages from plain ones by their first byte.
+const (
+	GzipMarker    byte = 0x01
+	DeflateMarker byte = 0x02
+)
+
+// DefaultCompressionThreshold is the message size, in bytes, above which messages are compressed unless
+// changed with SetCompressionThreshold.
+const DefaultCompressionThreshold = 1024
+
+// SetCompression sets the compression applied to messages larger than the compression threshold, which is
+// most useful for Log and Event messages carrying large bodies. A message is only sent compressed if that
+// makes it smaller. Compression is off by default because the agent must be configured to expect it.
+func (c *Client) SetCompression(compression Compression) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.compression = compression
+}
+
+// SetCompressionThreshold sets the size, in bytes, above which messages are compressed.
+func (c *Client) SetCompressionThreshold(threshold int) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.compressionThreshold = threshold
+}
+
+// Compress an encoded message according to the client's settings, returning it unchanged if it is small,
+// compression is off, or compressing doesn't shrink it.
+func (c *Client) compress(message []byte) []byte {
+	c.configMutex.RLock()
+	compression, threshold := c.compression, c.compressionThreshold
+	c.configMutex.RUnlock()
+	if compression == NoCompression || len(message) <= threshold {
+		return message
+	}
+
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch compression {
+	case Gzip:
+		buffer.WriteByte(GzipMarker)
+		writer = gzip.NewWriter(&buffer)
+	case Deflate:
+		buffer.WriteByte(DeflateMarker)
+		writer, _ = flate.NewWriter(&buffer, flate.DefaultCompression)
+	default:
+		return message
+	}
+	if _, err := writer.Write(message); err != nil {
+		return message
+	}
+	if err := writer.Close(); err != nil {
+		return message
+	}
+	if buffer.Len() >= len(message) {
+		return message
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,41 @@
+package hastur
+
+import (
+	"net"
+)
+
+// NewClientWithConn creates a Client which sends every message over conn instead of dialing the agent itself.
+// See SetConn.
+func NewClientWithConn(conn net.Conn) *Client {
+	c := newUnconnectedClient("udp", defaultUdpAddress, defaultUdpPort)
+	c.SetConn(conn)
+	return c
+}
+
+// SetConn makes the client send every message over conn, which the caller has already established, such as a
+// TLS connection or one taken from the caller's own pool. The client's own connection, if any, is closed.
+//
+// The client never closes conn, not even in Close, and doesn't re-dial if writes to it fail; managing it is
+// left to the caller. Messages are framed according to conn's network (as reported by its local address):
+// over "udp" and "unixgram" each message is a datagram, and over any other network, such as "tcp", each
+// message is terminated by a newline. The client's own network, address, and socket path are kept, and calling
+// SetNetwork, SetUdpAddress, SetUdpPort, or SetUnixSocket goes back to a connection dialed by the client.
+func (c *Client) SetConn(conn net.Conn) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.releaseConn()
+	c.conn = conn
+	c.externalConn = true
+	c.externalNetwork = "tcp"
+	if addr := conn.LocalAddr(); addr != nil {
+		c.externalNetwork = addr.Network()
+	}
+	c.closed = false
+	c.broken = false
+	c.reconnectDelay = 0
+}
+
+// SetConn makes the default client send every message over conn. See Client.SetConn.
+func SetConn(conn net.Conn) {
+	defaultClient.SetConn(conn)
+}
@@ -0,0 +1,121 @@
+package hastur
+
+import (
+	"context"
+)
+
+// A context key whose value is added to messages as a label (see RegisterContextLabel).
+type contextLabel struct {
+	key  interface{}
+	name string
+}
+
+// RegisterContextLabel arranges for the value stored in a context under key to be sent as the label name by
+// the *Ctx message methods, such as CounterCtx. This carries request-scoped values like trace IDs into
+// metrics without passing label maps down the call stack. Contexts which have no value for key are ignored.
+func (c *Client) RegisterContextLabel(key interface{}, name string) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	c.contextLabels = append(c.contextLabels, contextLabel{key: key, name: name})
+}
+
+// Prepend to opts an option adding the registered labels found in ctx.
+func (c *Client) withContext(ctx context.Context, opts []Option) []Option {
+	labels := make(map[string]interface{})
+	c.labelsMutex.RLock()
+	for _, label := range c.contextLabels {
+		if value := ctx.Value(label.key); value != nil {
+			labels[label.name] = value
+		}
+	}
+	c.labelsMutex.RUnlock()
+	// Labels given explicitly take precedence over those from the context.
+	return append([]Option{WithLabels(labels)}, opts...)
+}
+
+// MarkCtx is the same as Mark but adds the registered labels found in ctx.
+func (c *Client) MarkCtx(ctx context.Context, name, value string, opts ...Option) error {
+	return c.Mark(name, value, c.withContext(ctx, opts)...)
+}
+
+// CounterCtx is the same as Counter but adds the registered labels found in ctx.
+func (c *Client) CounterCtx(ctx context.Context, name string, value int, opts ...Option) error {
+	return c.Counter(name, value, c.withContext(ctx, opts)...)
+}
+
+// GaugeCtx is the same as Gauge but adds the registered labels found in ctx.
+func (c *Client) GaugeCtx(ctx context.Context, name string, value float64, opts ...Option) error {
+	return c.Gauge(name, value, c.withContext(ctx, opts)...)
+}
+
+// GaugeIntCtx is the same as GaugeInt but adds the registered labels found in ctx.
+func (c *Client) GaugeIntCtx(ctx context.Context, name string, value int, opts ...Option) error {
+	return c.GaugeInt(name, value, c.withContext(ctx, opts)...)
+}
+
+// TimerCtx is the same as Timer but adds the registered labels found in ctx.
+func (c *Client) TimerCtx(ctx context.Context, name string, value float64, opts ...Option) error {
+	return c.Timer(name, value, c.withContext(ctx, opts)...)
+}
+
+// SetCtx is the same as Set but adds the registered labels found in ctx.
+func (c *Client) SetCtx(ctx context.Context, name, value string, opts ...Option) error {
+	return c.Set(name, value, c.withContext(ctx, opts)...)
+}
+
+// EventCtx is the same as Event but adds the registered labels found in ctx.
+func (c *Client) EventCtx(ctx context.Context, name, subject, body string, attn []string, opts ...Option) error {
+	return c.Event(name, subject, body, attn, c.withContext(ctx, opts)...)
+}
+
+// LogCtx is the same as Log but adds the registered labels found in ctx.
+func (c *Client) LogCtx(ctx context.Context, subject string, data interface{}, opts ...Option) error {
+	return c.Log(subject, data, c.withContext(ctx, opts)...)
+}
+
+// RegisterContextLabel arranges for the default client to send the value stored in a context under key as the
+// label name. See Client.RegisterContextLabel.
+func RegisterContextLabel(key interface{}, name string) {
+	defaultClient.RegisterContextLabel(key, name)
+}
+
+// MarkCtx sends a 'mark' stat with labels from ctx using the default client. See Client.MarkCtx.
+func MarkCtx(ctx context.Context, name, value string, opts ...Option) {
+	defaultClient.MarkCtx(ctx, name, value, opts...)
+}
+
+// CounterCtx sends a 'counter' stat with labels from ctx using the default client. See Client.CounterCtx.
+func CounterCtx(ctx context.Context, name string, value int, opts ...Option) {
+	defaultClient.CounterCtx(ctx, name, value, opts...)
+}
+
+// GaugeCtx sends a 'gauge' stat with labels from ctx using the default client. See Client.GaugeCtx.
+func GaugeCtx(ctx context.Context, name string, value float64, opts ...Option) {
+	defaultClient.GaugeCtx(ctx, name, value, opts...)
+}
+
+// GaugeIntCtx sends an integer 'gauge' stat with labels from ctx using the default client. See
+// Client.GaugeIntCtx.
+func GaugeIntCtx(ctx context.Context, name string, value int, opts ...Option) {
+	defaultClient.GaugeIntCtx(ctx, name, value, opts...)
+}
+
+// TimerCtx sends a 'timer' stat with labels from ctx using the default client. See Client.TimerCtx.
+func TimerCtx(ctx context.Context, name string, value float64, opts ...Option) {
+	defaultClient.TimerCtx(ctx, name, value, opts...)
+}
+
+// SetCtx sends a 'set' stat with labels from ctx using the default client. See Client.SetCtx.
+func SetCtx(ctx context.Context, name, value string, opts ...Option) {
+	defaultClient.SetCtx(ctx, name, value, opts...)
+}
+
+// EventCtx sends an event with labels from ctx using the default client. See Client.EventCtx.
+func EventCtx(ctx context.Context, name, subject, body string, attn []string, opts ...Option) {
+	defaultClient.EventCtx(ctx, name, subject, body, attn, opts...)
+}
+
+// LogCtx sends a log line with labels from ctx using the default client. See Client.LogCtx.
+func LogCtx(ctx context.Context, subject string, data interface{}, opts ...Option) {
+	defaultClient.LogCtx(ctx, subject, data, opts...)
+}
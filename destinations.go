@@ -0,0 +1,77 @@
+package hastur
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrDestinationUnsupported is returned by AddDestination when the client's network has no notion of a host
+// and port, as with a Unix socket.
+var ErrDestinationUnsupported = errors.New("hastur: additional destinations require a udp or tcp network")
+
+// A destination which receives a copy of every message in addition to the client's main destination.
+type destination struct {
+	address string
+	port    int
+	conn    net.Conn
+}
+
+// AddDestination adds a destination which receives a copy of every message sent by the client, in addition to
+// the destination given by the client's address and port. This is useful for mirroring messages to two agents
+// during a migration. The destination is dialed over the client's network, which must be a udp or tcp
+// network; otherwise ErrDestinationUnsupported is returned. Failing to write to one destination doesn't
+// prevent delivery to the others; the message method returns the combined errors. Additional destinations are
+// not re-dialed after failures.
+func (c *Client) AddDestination(address string, port int) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if !strings.HasPrefix(c.network, "udp") && !strings.HasPrefix(c.network, "tcp") {
+		return ErrDestinationUnsupported
+	}
+	conn, err := c.dialAddress(net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	c.destinations = append(c.destinations, &destination{address: address, port: port, conn: conn})
+	return nil
+}
+
+// RemoveDestination closes and removes a destination previously added with AddDestination. It does nothing if
+// there is no such destination.
+func (c *Client) RemoveDestination(address string, port int) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	remaining := c.destinations[:0]
+	for _, d := range c.destinations {
+		if d.address == address && d.port == port {
+			d.conn.Close()
+			continue
+		}
+		remaining = append(remaining, d)
+	}
+	c.destinations = remaining
+}
+
+// Write bytes to each additional destination, returning any errors. The caller must hold connMutex.
+func (c *Client) writeDestinations(bytes []byte) []error {
+	var errs []error
+	for _, d := range c.destinations {
+		c.setWriteDeadline(d.conn)
+		if _, err := d.conn.Write(bytes); err != nil {
+			destination := net.JoinHostPort(d.address, strconv.Itoa(d.port))
+			errs = append(errs, fmt.Errorf("hastur: destination %s: %w", destination, err))
+		}
+	}
+	return errs
+}
+
+// Close and forget every additional destination. The caller must hold connMutex for writing.
+func (c *Client) closeDestinations() {
+	for _, d := range c.destinations {
+		d.conn.Close()
+	}
+	c.destinations = nil
+}
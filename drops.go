@@ -0,0 +1,79 @@
+package hastur
+
+import (
+	"errors"
+)
+
+// ErrMessageTooLarge is returned when an encoded message is too large to be sent in a single UDP datagram.
+var ErrMessageTooLarge = errors.New("hastur: message too large for a datagram")
+
+// The largest payload that fits in a UDP datagram.
+const maxDatagramSize = 65507
+
+// DropReason identifies why a message was not delivered to the connection.
+type DropReason int
+
+const (
+	// DropMarshalError counts messages which could not be encoded.
+	DropMarshalError DropReason = iota
+	// DropQueueFull counts messages discarded because the asynchronous send queue was full.
+	DropQueueFull
+	// DropTooLarge counts messages too large to be sent in a UDP datagram.
+	DropTooLarge
+	// DropNotConnected counts messages sent while the client had no connection.
+	DropNotConnected
+	// DropClosed counts messages sent after the client was closed.
+	DropClosed
+	// DropWriteError counts messages whose write to the connection failed.
+	DropWriteError
+	// DropInvalidName counts messages rejected because of an invalid name in strict mode.
+	DropInvalidName
+	// DropRateLimited counts messages over a rate limit (see SetRateLimit).
+	DropRateLimited
+	// DropFiltered counts messages rejected by the metric filter (see SetMetricFilter).
+	DropFiltered
+	numDropReasons
+)
+
+var dropReasonNames = [numDropReasons]string{
+	DropMarshalError: "marshal_error",
+	DropQueueFull:    "queue_full",
+	DropTooLarge:     "too_large",
+	DropNotConnected: "not_connected",
+	DropClosed:       "closed",
+	DropWriteError:   "write_error",
+	DropInvalidName:  "invalid_name",
+	DropRateLimited:  "rate_limited",
+	DropFiltered:     "filtered",
+}
+
+// String returns a short snake_case name for the reason, such as "queue_full".
+func (r DropReason) String() string {
+	if r < 0 || r >= numDropReasons {
+		return "unknown"
+	}
+	return dropReasonNames[r]
+}
+
+func (c *Client) drop(reason DropReason) { c.drops[reason].Add(1) }
+
+// DroppedMessages returns the total number of messages the client has dropped for any reason.
+func (c *Client) DroppedMessages() uint64 {
+	var total uint64
+	for i := range c.drops {
+		total += c.drops[i].Load()
+	}
+	return total
+}
+
+// DroppedMessagesByReason returns the number of messages the client has dropped, keyed by reason. Reasons with
+// no drops are omitted.
+func (c *Client) DroppedMessagesByReason() map[DropReason]uint64 {
+	counts := make(map[DropReason]uint64)
+	for i := range c.drops {
+		if count := c.drops[i].Load(); count > 0 {
+			counts[DropReason(i)] = count
+		}
+	}
+	return counts
+}
@@ -0,0 +1,54 @@
+package hastur
+
+import (
+	"io"
+)
+
+// SetDryRun turns on dry-run mode, in which each message is encoded and written to w, followed by a newline,
+// instead of being sent. Messages are written before compression, so with the default encoder w receives
+// exactly the JSON the agent would. This is useful for checking field names, timestamps, and label merging
+// locally. A nil writer turns dry-run mode off.
+func (c *Client) SetDryRun(w io.Writer) {
+	c.outputMutex.Lock()
+	defer c.outputMutex.Unlock()
+	c.dryRun = w
+}
+
+// SetOutput sets a writer which receives a copy of each message, encoded and followed by a newline, in addition
+// to the message being sent. For instance, SetOutput(os.Stdout) shows what a program emits during local
+// development. As with SetDryRun, messages are written before compression. Errors writing to w are ignored. A
+// nil writer stops the copies.
+func (c *Client) SetOutput(w io.Writer) {
+	c.outputMutex.Lock()
+	defer c.outputMutex.Unlock()
+	c.output = w
+}
+
+// Write an encoded message to the output writer and to the dry-run writer, if there are any, reporting whether
+// the message went to the dry-run writer (and so should not be sent).
+func (c *Client) writeLocal(bytes []byte) (bool, error) {
+	c.outputMutex.Lock()
+	defer c.outputMutex.Unlock()
+	if c.output == nil && c.dryRun == nil {
+		return false, nil
+	}
+	line := append(bytes[:len(bytes):len(bytes)], '\n')
+	if c.output != nil {
+		c.output.Write(line)
+	}
+	if c.dryRun == nil {
+		return false, nil
+	}
+	_, err := c.dryRun.Write(line)
+	return true, err
+}
+
+// SetDryRun writes the default client's messages to w instead of sending them. See Client.SetDryRun.
+func SetDryRun(w io.Writer) {
+	defaultClient.SetDryRun(w)
+}
+
+// SetOutput writes a copy of the default client's messages to w. See Client.SetOutput.
+func SetOutput(w io.Writer) {
+	defaultClient.SetOutput(w)
+}
@@ -0,0 +1,25 @@
+package hastur
+
+// SetEnabled turns the client on or off. While it is disabled, every message method returns nil right away
+// without encoding or writing anything, or counting the message against the metric filter and rate limits,
+// and tasks started with Every and its variants (including the heartbeat started by Start) skip their runs.
+// This lets instrumentation stay in place while being silenced, for instance in the unit tests of other
+// packages. Clients are enabled by default, and re-enabling one resumes sending on its existing connection.
+func (c *Client) SetEnabled(enabled bool) {
+	c.disabled.Store(!enabled)
+}
+
+// Enabled reports whether the client is enabled (see SetEnabled).
+func (c *Client) Enabled() bool {
+	return !c.disabled.Load()
+}
+
+// SetEnabled turns the default client on or off. See Client.SetEnabled.
+func SetEnabled(enabled bool) {
+	defaultClient.SetEnabled(enabled)
+}
+
+// Enabled reports whether the default client is enabled.
+func Enabled() bool {
+	return defaultClient.Enabled()
+}
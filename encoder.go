@@ -0,0 +1,51 @@
+package hastur
+
+import (
+	"encoding/json"
+)
+
+// Encoder converts a message into the bytes written to the agent. Messages are structs whose json tags give
+// the field names, holding maps, slices, strings, and numbers, so any general-purpose serialization format
+// which honors json tags can be used.
+//
+// The default encoder is JSONEncoder. To use MessagePack instead (assuming your agent accepts it), wrap the
+// Marshal function of your preferred MessagePack library, set up to use json tags, with EncoderFunc:
+//
+//	hastur.SetEncoder(hastur.EncoderFunc(msgpack.Marshal))
+type Encoder interface {
+	Marshal(message interface{}) ([]byte, error)
+}
+
+// EncoderFunc adapts an ordinary marshalling function to the Encoder interface.
+type EncoderFunc func(message interface{}) ([]byte, error)
+
+// Marshal calls f(message).
+func (f EncoderFunc) Marshal(message interface{}) ([]byte, error) { return f(message) }
+
+// JSONEncoder encodes messages as JSON. This is the format the Hastur agent expects by default.
+//
+// The encoding is deterministic: encoding/json writes map keys, including those of labels, tags, and nested
+// label values, in sorted order, and message fields are declared in the same order. So two messages with the
+// same contents encode to the same bytes, which lets a gateway deduplicate retransmitted messages by hashing
+// them. An Encoder wrapping another library may need to be told to sort map keys for the same guarantee.
+type JSONEncoder struct{}
+
+// Marshal encodes message using encoding/json.
+func (JSONEncoder) Marshal(message interface{}) ([]byte, error) { return json.Marshal(message) }
+
+// SetEncoder sets the encoder used to convert messages to bytes. A nil encoder restores the default
+// JSONEncoder.
+func (c *Client) SetEncoder(encoder Encoder) {
+	if encoder == nil {
+		encoder = JSONEncoder{}
+	}
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.encoder = encoder
+}
+
+func (c *Client) currentEncoder() Encoder {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	return c.encoder
+}
@@ -0,0 +1,37 @@
+package hastur
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Read the default client's configuration from the environment: the agent's address from HASTUR_UDP_ADDRESS,
+// its port from HASTUR_UDP_PORT, and default labels from HASTUR_LABELS, a comma-separated list of key=value
+// pairs. Unset variables leave the built-in defaults in place, and invalid values are logged and ignored.
+func configFromEnv() (address string, port int, labels map[string]interface{}) {
+	address, port, labels = defaultUdpAddress, defaultUdpPort, make(map[string]interface{})
+	if value := os.Getenv("HASTUR_UDP_ADDRESS"); value != "" {
+		address = value
+	}
+	if value := os.Getenv("HASTUR_UDP_PORT"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 65535 {
+			port = parsed
+		} else {
+			log.Printf("hastur: ignoring invalid HASTUR_UDP_PORT %q", value)
+		}
+	}
+	for _, pair := range strings.Split(os.Getenv("HASTUR_LABELS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			log.Printf("hastur: ignoring invalid label %q in HASTUR_LABELS", pair)
+			continue
+		}
+		labels[key] = value
+	}
+	return address, port, labels
+}
@@ -0,0 +1,31 @@
+package hastur
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// EventWithID is the same as Event but returns the ID of the event. Every event carries a randomly generated
+// (version 4) UUID under "id", which the agent uses to acknowledge it, so the ID can be used to track the
+// event's delivery.
+func (c *Client) EventWithID(name, subject, body string, attn []string, opts ...Option) (string, error) {
+	id := newEventID()
+	return id, c.eventFull(id, name, subject, body, attn, c.applyOptions(opts))
+}
+
+// Generate a random version 4 UUID.
+func newEventID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(fmt.Sprintf("hastur: unable to generate event ID: %s", err))
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// EventWithID sends an event to Hastur using the default client and returns its ID. See Client.EventWithID.
+func EventWithID(name, subject, body string, attn []string, opts ...Option) string {
+	id, _ := defaultClient.EventWithID(name, subject, body, attn, opts...)
+	return id
+}
@@ -0,0 +1,81 @@
+package hastur
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock whose time only changes when advanced explicitly.
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock { return &FakeClock{now: now} }
+
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// SetClock replaces the clock of the given client (or of the default client, if c is nil) and returns a
+// function which restores the previous clock. It must not be called while the client is in use by other
+// goroutines.
+func SetClock(c *Client, now clock) (restore func()) {
+	if c == nil {
+		c = defaultClient
+	}
+	previous := c.clock
+	c.clock = now
+	return func() { c.clock = previous }
+}
+
+// ConfigFromEnv exposes the environment parsing done when the package is initialized.
+var ConfigFromEnv = configFromEnv
+
+// ReportSelfMetrics sends one round of the gauges reported by StartSelfMetrics.
+func ReportSelfMetrics(c *Client) error {
+	return c.reportSelfMetrics()
+}
+
+// ReportRuntimeMetrics sends one round of the gauges reported by StartRuntimeMetrics.
+func ReportRuntimeMetrics(c *Client) error {
+	var last runtime.MemStats
+	runtime.ReadMemStats(&last)
+	runtime.GC()
+	return c.reportRuntimeMetrics(&last)
+}
+
+// ReportUptime sends one round of the gauge reported by StartUptimeMetric.
+func ReportUptime(c *Client) error {
+	return c.reportUptime()
+}
+
+// GaugeFuncEvery is the same as Client.GaugeFunc but with an arbitrary interval.
+func GaugeFuncEvery(c *Client, name string, d time.Duration, fn func() float64) Stopper {
+	return c.gaugeFunc(name, d, fn)
+}
+
+// CounterFuncEvery is the same as Client.CounterFunc but with an arbitrary interval.
+func CounterFuncEvery(c *Client, name string, d time.Duration, fn func() int64) Stopper {
+	return c.counterFunc(name, d, fn)
+}
+
+// NextScheduled returns the first time after after matching an EveryAt schedule.
+func NextScheduled(spec string, after time.Time) (time.Time, error) {
+	s, err := parseSchedule(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.next(after), nil
+}
@@ -0,0 +1,63 @@
+package hastur
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrFiltered is returned when a message is dropped by the metric filter (see SetMetricFilter).
+var ErrFiltered = errors.New("hastur: message rejected by metric filter")
+
+// MetricFilter decides whether a message with the given name and type (such as "counter") is sent.
+type MetricFilter func(name, messageType string) bool
+
+// SetMetricFilter sets a filter consulted for every named message (marks, sets, counters, gauges, timers,
+// compound messages, histograms, events, and heartbeats) before anything else is done with it. The filter sees the name
+// as given, before any prefix is applied. When it returns false, the message is dropped (and counted, with
+// DropFiltered) and the message method returns ErrFiltered. This lets operators silence noisy metrics without
+// changing the code which sends them. A nil filter, the default, sends everything.
+func (c *Client) SetMetricFilter(filter MetricFilter) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.metricFilter = filter
+}
+
+// AllowPrefixes returns a MetricFilter which sends only messages whose names begin with one of prefixes.
+func AllowPrefixes(prefixes ...string) MetricFilter {
+	return func(name, messageType string) bool {
+		return hasAnyPrefix(name, prefixes)
+	}
+}
+
+// DenyPrefixes returns a MetricFilter which drops messages whose names begin with one of prefixes.
+func DenyPrefixes(prefixes ...string) MetricFilter {
+	return func(name, messageType string) bool {
+		return !hasAnyPrefix(name, prefixes)
+	}
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether the metric filter allows a message, counting it as dropped if not.
+func (c *Client) filter(name, messageType string) bool {
+	c.configMutex.RLock()
+	filter := c.metricFilter
+	c.configMutex.RUnlock()
+	if filter == nil || filter(name, messageType) {
+		return true
+	}
+	c.drop(DropFiltered)
+	return false
+}
+
+// SetMetricFilter sets the default client's metric filter. See Client.SetMetricFilter.
+func SetMetricFilter(filter MetricFilter) {
+	defaultClient.SetMetricFilter(filter)
+}
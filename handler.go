@@ -0,0 +1,113 @@
+package hastur
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// MarshalError is returned when a message cannot be encoded, for instance because a label value cannot be
+// converted to JSON.
+type MarshalError struct {
+	Err error
+}
+
+func (e *MarshalError) Error() string { return "hastur: error marshalling message: " + e.Err.Error() }
+
+// Unwrap returns the encoder's error.
+func (e *MarshalError) Unwrap() error { return e.Err }
+
+// ErrorHandler is called when a message cannot be sent. messageType is the type of the failed message (such
+// as "counter" or "event").
+type ErrorHandler func(err error, messageType string)
+
+// SetErrorHandler sets a function to be called whenever sending a message fails, so that failures can be
+// routed to the application's own logging or alerting. A nil handler restores the default, which reports
+// marshalling failures to Hastur as log messages, logs warnings from SetGaugeMonotonicWarn with the standard
+// log package, and ignores other errors.
+//
+// The handler is called without any of the client's locks held, and may itself send messages. To prevent
+// infinite recursion, errors from messages sent by the handler itself are not passed to a handler; errors from
+// other goroutines are, even while a handler is running, so the handler may be called concurrently. When
+// sending asynchronously, the handler is called on its own goroutine.
+func (c *Client) SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		c.errorHandler.Store(nil)
+		return
+	}
+	c.errorHandler.Store(&handler)
+}
+
+// Record a send failure for Snapshot and pass it to the error handler, unless it came from the handler.
+func (c *Client) handleError(err error, failed interface{}) {
+	c.lastError.Store(&err)
+	c.callErrorHandler(err, failed)
+}
+
+// Pass err, concerning the message failed, to the error handler, unless the message was sent by the handler or
+// the handler is running further up this goroutine's stack.
+func (c *Client) callErrorHandler(err error, failed interface{}) {
+	messageType := ""
+	if m, ok := failed.(message); ok {
+		if m.sentByHandler() {
+			return
+		}
+		messageType = m.messageType()
+	}
+	if c.inErrorHandler() {
+		return
+	}
+	c.runErrorHandler(err, messageType)
+}
+
+// Call the error handler. inErrorHandler recognizes a goroutine running it by this function on the stack.
+func (c *Client) runErrorHandler(err error, messageType string) {
+	c.handlersRunning.Add(1)
+	defer c.handlersRunning.Add(-1)
+	if handler := c.errorHandler.Load(); handler != nil {
+		(*handler)(err, messageType)
+		return
+	}
+	c.defaultErrorHandler(err, messageType)
+}
+
+// Report whether the calling goroutine is inside a call to an error handler. Go has no goroutine-local
+// storage, so this looks for runErrorHandler on the stack, which is only done while a handler is running.
+func (c *Client) inErrorHandler() bool {
+	if c.handlersRunning.Load() == 0 {
+		return false
+	}
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(2, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if strings.HasSuffix(frame.Function, ".(*Client).runErrorHandler") {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// Report marshalling failures to Hastur as a log message, and log warnings about gauges.
+func (c *Client) defaultErrorHandler(err error, messageType string) {
+	var marshalErr *MarshalError
+	if errors.As(err, &marshalErr) {
+		c.Log(fmt.Sprintf("Error marshalling message: %s", marshalErr.Err.Error()), "")
+	}
+	var warning *MonotonicGaugeWarning
+	if errors.As(err, &warning) {
+		log.Print(warning.Error())
+	}
+}
@@ -8,51 +8,65 @@ Message methods each publish a single Hastur message to a local port via UDP. Mo
 two variants, the method and its "full" version (e.g., Mark and MarkFull). The Full version allows you to
 specify all the available fields for the message, while the normal method only takes the most commonly used
 parameters and uses the typical defaults for the remaining arguments (for example, the current time for
-"timestamp" and an empty map for "labels").
+"timestamp" and an empty map for "labels"). A zero time.Time given to a Full method also means the current
+time.
 
 The utility methods take care of some of the boilerplate for common Hastur client usages. For instance, Time,
 TimeFull, and TimeCurrent each help time functions or code blocks and send results as a gauge. Every allows
 for running some state reporting code on a regular interval. Functions are also provided to obtain and modify
 the target UDP address/port and the default labels applied to all Hastur messages.
 
-The app name and process ID are attached as labels to every Hastur message (as "app" and "pid", respectively).
-The app name is chosen from either (a) a name set by SetAppName, (b) the environment variable HASTUR_APP_NAME,
-or (c) the process name (preferred in that order).
+The package-level functions all operate on a default client which publishes to 127.0.0.1:8125. If you need to
+publish to several destinations from the same process, or want isolated state (for instance in tests), create
+your own clients with NewClient; a Client has the same message and utility methods as the package.
+
+Messages are normally marshalled and written on the calling goroutine. SetAsync moves this work to a background
+goroutine fed by a buffered queue; call Flush or Close to make sure queued messages have been written.
+
+The app name, process ID, and hostname are attached as labels to every Hastur message (as "app", "pid", and
+"host", respectively). The app name is chosen from either (a) a name set by SetAppName, (b) the environment
+variable HASTUR_APP_NAME, or (c) the process name (preferred in that order).
+
+The default client sends to the agent on 127.0.0.1:8125. The environment variables HASTUR_UDP_ADDRESS and
+HASTUR_UDP_PORT override the address and port, and HASTUR_LABELS adds default labels given as comma-separated
+key=value pairs (for instance "region=us,tier=web").
 
 You may call Start to automatically register your application and send heartbeat messages. This currently
 sends messages each minute. If you set SendProcessHeartbeat to false before calling Start, heartbeat messages
-will not be sent.
+will not be sent. StopHeartbeat halts a running heartbeat. During graceful shutdown, call Shutdown instead:
+it stops the heartbeat, writes out any queued messages, and closes the default client.
 */
 package hastur
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net"
+	"log"
+	"math/rand"
 	"os"
+	"sync"
 	"time"
 )
 
 var (
 	// Version is the current Go Hastur client library version.
-	Version       = "0.0.1"
-	udpAddress    = "127.0.0.1"
-	udpPort       = 8125
-	appName       string
-	conn          net.Conn
-	defaultLabels = make(map[string]interface{})
-	recurringSend = false
+	Version        = "0.0.1"
+	defaultClient  *Client
+	hostname       string
+	heartbeatMutex sync.Mutex
+	heartbeat      Stopper
 	// SendProcessHearbeat controls whether Start begins a periodic application heartbeat.
 	SendProcessHeartbeat = true
+	// processStart approximates when the process started, for RegisterProcess.
+	processStart = time.Now()
+	// pid is the process ID, which is attached to every message.
+	pid = os.Getpid()
 )
 
-func establishConn() {
-	var err error
-	conn, err = net.Dial("udp", fmt.Sprintf("%s:%d", udpAddress, udpPort))
-	if err != nil {
-		panic(err)
-	}
-}
+const (
+	defaultUdpAddress = "127.0.0.1"
+	defaultUdpPort    = 8125
+)
 
 // Interval specifies one of the time intervals that may be used in a call to Every.
 type Interval int
@@ -73,21 +87,50 @@ var intervalToDuration = map[Interval]time.Duration{
 
 // TimeFull is the same as Time but allows for explicit setting of the timestamp and labels.
 func TimeFull(callback func(), name string, timestamp time.Time, labels map[string]interface{}) {
-	start := time.Now()
-	callback()
-	end := time.Now()
-	GaugeFull(name, end.Sub(start).Seconds(), timestamp, labels)
+	defaultClient.TimeFull(callback, name, timestamp, labels)
 }
 
-// Time runs a function and reports its runtime to Hastur as a gauge. callback is the function to run; name
-// will be the name of the gauge message.
+// Time runs a function and reports its runtime to Hastur as a gauge (or a timer; see SetReportTimers).
+// callback is the function to run; name will be the name of the gauge message.
 func Time(callback func(), name string) {
-	TimeFull(callback, name, time.Now(), make(map[string]interface{}))
+	defaultClient.Time(callback, name)
+}
+
+// TimeSampled runs a function and, with probability rate, reports its runtime using the default client. See
+// Client.TimeSampled.
+func TimeSampled(callback func(), name string, rate float64) {
+	defaultClient.TimeSampled(callback, name, rate)
+}
+
+// TimeErr is the same as Time but for a callback which may fail. The reported gauge carries an "error" label
+// which is true if callback returned an error and false otherwise. The callback's error is returned
+// unchanged.
+func TimeErr(callback func() error, name string) error {
+	return defaultClient.TimeErr(callback, name)
+}
+
+// TimeValue is the same as Time but for a function which returns a value, which TimeValue passes back to the
+// caller.
+func TimeValue[T any](name string, fn func() T) T {
+	var value T
+	defaultClient.Time(func() { value = fn() }, name)
+	return value
+}
+
+// TimeValueErr is the same as TimeErr but for a function which returns a value along with its error. Both are
+// passed back to the caller unchanged.
+func TimeValueErr[T any](name string, fn func() (T, error)) (T, error) {
+	var value T
+	err := defaultClient.TimeErr(func() (err error) {
+		value, err = fn()
+		return err
+	}, name)
+	return value, err
 }
 
 // TimeCurrent provides a convenient way to measure the time until the current function returns and report it
-// to Hastur as a gauge. name is the name of the gauge and start is the starting time for measurement
-// (generally time.Now()). This should be called using defer.
+// to Hastur as a gauge (or a timer; see SetReportTimers). name is the name of the gauge and start is the
+// starting time for measurement (generally time.Now()). This should be called using defer.
 //
 // Example:
 //
@@ -96,346 +139,599 @@ func Time(callback func(), name string) {
 //         ...
 //     }
 func TimeCurrent(name string, start time.Time) {
-	end := time.Now()
-	Gauge(name, end.Sub(start).Seconds())
+	defaultClient.TimeCurrent(name, start)
+}
+
+// TimeCurrentFull is the same as TimeCurrent but attaches labels to the reported gauge. Because defer
+// evaluates its arguments immediately, the labels are captured at the defer statement:
+//
+//	defer hastur.TimeCurrentFull("handler", time.Now(), map[string]interface{}{"route": route})
+func TimeCurrentFull(name string, start time.Time, labels map[string]interface{}) {
+	defaultClient.TimeCurrentFull(name, start, labels)
+}
+
+// Stopper halts a periodic task, such as one started by Every.
+type Stopper interface {
+	// Stop halts the task. The callback will not be started again after Stop returns, although an invocation
+	// already in progress runs to completion. Calling Stop more than once is harmless.
+	Stop()
+}
+
+// cancelStopper is a Stopper which cancels the context driving a periodic task.
+type cancelStopper context.CancelFunc
+
+func (s cancelStopper) Stop() { s() }
+
+// SetPrefix sets a prefix for the names of messages sent by the default client. See Client.SetPrefix.
+func SetPrefix(prefix string) {
+	defaultClient.SetPrefix(prefix)
+}
+
+// Prefix returns the prefix set with SetPrefix.
+func Prefix() string {
+	return defaultClient.Prefix()
+}
+
+// SetPrefixSeparator sets the string placed between the prefix and the name (by default, ".").
+func SetPrefixSeparator(separator string) {
+	defaultClient.SetPrefixSeparator(separator)
+}
+
+// SetStrictNames controls whether the default client drops messages with invalid names rather than
+// sanitizing them. See Client.SetStrictNames.
+func SetStrictNames(strict bool) {
+	defaultClient.SetStrictNames(strict)
+}
+
+// SetReportTimers controls whether Time, TimeFull, and TimeCurrent report durations as timer messages rather
+// than gauges.
+func SetReportTimers(enabled bool) {
+	defaultClient.SetReportTimers(enabled)
 }
 
 // Every runs callback code repeatedly at a fixed time interval. You can use this to collect and report
-// periodic statistics. This is used by the default heartbeat message when you call Start.
-func Every(interval Interval, callback func()) {
+// periodic statistics. This is used by the default heartbeat message when you call Start. Call Stop on the
+// returned Stopper to halt the task and release its ticker.
+//
+// If callback takes longer than the interval, the runs which would have started in the meantime are skipped
+// rather than queued, and the next run waits for the following tick. Skipped runs are counted in the default
+// client's Stats.
+func Every(interval Interval, callback func()) Stopper {
+	return EveryContext(context.Background(), interval, callback)
+}
+
+// EveryContext is the same as Every but also halts the task when ctx is done.
+func EveryContext(ctx context.Context, interval Interval, callback func()) Stopper {
 	duration, ok := intervalToDuration[interval]
 	if !ok {
 		panic(fmt.Sprintf("Every called with bad interval."))
 	}
+	return every(ctx, defaultClient, duration, false, callback)
+}
+
+// EveryImmediate is the same as Every but also runs callback once right away, rather than waiting a full
+// interval for the first run. The first run happens on the task's goroutine, so EveryImmediate doesn't block.
+func EveryImmediate(interval Interval, callback func()) Stopper {
+	duration, ok := intervalToDuration[interval]
+	if !ok {
+		panic(fmt.Sprintf("EveryImmediate called with bad interval."))
+	}
+	return every(context.Background(), defaultClient, duration, true, callback)
+}
+
+// EveryDuration is the same as Every but accepts an arbitrary interval. It panics if duration is not positive.
+func EveryDuration(duration time.Duration, callback func()) Stopper {
+	if duration <= 0 {
+		panic(fmt.Sprintf("EveryDuration called with non-positive duration %s.", duration))
+	}
+	return every(context.Background(), defaultClient, duration, false, callback)
+}
+
+// EveryJittered is the same as EveryDuration but moves each run earlier or later by a random amount of up to
+// jitter times duration, so that many processes started together don't report in lockstep. It panics if
+// duration is not positive or jitter is not between 0 and 1.
+func EveryJittered(duration time.Duration, jitter float64, callback func()) Stopper {
+	if duration <= 0 {
+		panic(fmt.Sprintf("EveryJittered called with non-positive duration %s.", duration))
+	}
+	if jitter < 0 || jitter > 1 {
+		panic(fmt.Sprintf("EveryJittered called with jitter %g outside [0, 1].", jitter))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
+		timer := time.NewTimer(jittered(duration, jitter))
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if defaultClient.Enabled() {
+					callback()
+				}
+				timer.Reset(jittered(duration, jitter))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cancelStopper(cancel)
+}
+
+// Return duration adjusted by a random amount of up to jitter times duration in either direction.
+func jittered(duration time.Duration, jitter float64) time.Duration {
+	return duration + time.Duration((rand.Float64()*2-1)*jitter*float64(duration))
+}
+
+// Run callback every duration until ctx is done or the returned Stopper is stopped, skipping runs while c is
+// disabled. If immediate is true, callback also runs once at the start. Ticks which come due while callback is
+// running are skipped (and counted in c's Stats), so a slow callback never runs back to back.
+func every(ctx context.Context, c *Client, duration time.Duration, immediate bool, callback func()) Stopper {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		if immediate && c.Enabled() {
+			callback()
+		}
 		ticker := time.NewTicker(duration)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
+				if !c.Enabled() {
+					continue
+				}
+				start := time.Now()
 				callback()
+				if skipped := time.Since(start) / duration; skipped > 0 {
+					c.skippedTicks.Add(uint64(skipped))
+					select {
+					case <-ticker.C:
+					default:
+					}
+				}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
+	return cancelStopper(cancel)
 }
 
-// Start sends a periodic process heartbeat message once per minute.
+// Start sends a periodic process heartbeat message once per minute, along with a
+// "hastur.client.dropped_messages" gauge reporting the default client's DroppedMessages. Calling Start again
+// replaces any heartbeat started by a previous call.
+//
+// Start also registers the process (see RegisterProcess) and doesn't return until the registration has been
+// written, even when sending asynchronously, so that it isn't lost if a short-lived job exits right away.
 func Start() {
+	StartContext(context.Background())
+}
+
+// StartContext is the same as Start but also halts the heartbeat when ctx is done.
+func StartContext(ctx context.Context) {
 	if SendProcessHeartbeat {
-		Every(Minute, func() {
-			HeartbeatFull("process_heartbeat", 0, 0, time.Now(), make(map[string]interface{}))
+		heartbeatMutex.Lock()
+		if heartbeat != nil {
+			heartbeat.Stop()
+		}
+		heartbeat = EveryContext(ctx, Minute, func() {
+			HeartbeatFull("process_heartbeat", 0, 0, defaultClient.clock.Now(), make(map[string]interface{}))
+			gaugeFull(defaultClient, "hastur.client.dropped_messages", float64(DroppedMessages()),
+				defaultClient.internalOptions())
 		})
+		heartbeatMutex.Unlock()
 	}
-	RegisterProcess(AppName(), make(map[string]interface{}), time.Now(), make(map[string]interface{}))
+	RegisterProcess(AppName(), make(map[string]interface{}), defaultClient.clock.Now(), make(map[string]interface{}))
+	Flush()
 }
 
-func init() {
-	establishConn()
+// StopHeartbeat halts the periodic heartbeat begun by Start. It does nothing if no heartbeat is running.
+func StopHeartbeat() {
+	heartbeatMutex.Lock()
+	defer heartbeatMutex.Unlock()
+	if heartbeat != nil {
+		heartbeat.Stop()
+		heartbeat = nil
+	}
 }
 
-// Send an arbitrary message to the udp destination.
-func send(message interface{}) {
-	bytes, err := json.Marshal(message)
+func init() {
+	// If the hostname can't be determined, the "host" label is omitted.
+	hostname, _ = os.Hostname()
+	address, port, labels := configFromEnv()
+	// Never fail at import time: if the dial fails, the default client retries it when messages are sent.
+	var err error
+	defaultClient, err = newClient("udp", address, port)
 	if err != nil {
-		if recurringSend {
-			return
-		}
-		recurringSend = true
-		defer func() { recurringSend = false }()
-		Log(fmt.Sprintf("Error marshalling json message: %s", err.Error()), "")
-		return
+		log.Printf("hastur: unable to connect to the agent: %s", err)
+	}
+	defaultClient.AddDefaultLabels(labels)
+}
+
+// clock is the source of the current time for timestamps and durations. Tests may substitute a fake clock.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Network returns the network the default client dials (defaulting to "udp").
+func Network() string { return defaultClient.Network() }
+
+// SetNetwork sets the network the default client dials, such as "tcp". If the dial fails, the failure is logged
+// and the dial is retried when messages are sent. See Client.SetNetwork.
+func SetNetwork(network string) {
+	if err := defaultClient.SetNetwork(network); err != nil {
+		log.Printf("hastur: unable to connect to the agent: %s", err)
 	}
-	conn.Write(bytes)
 }
 
-// Convert time.Time to Hastur's time format (microseconds since epoch)
-func convertTime(t time.Time) int64 { return t.UnixNano() / 1000 }
+// SetUnixSocket switches the default client to sending through the Unix domain datagram socket at path. If
+// the socket cannot be dialed, an error is returned and the current connection is kept. See
+// Client.SetUnixSocket.
+func SetUnixSocket(path string) error {
+	return defaultClient.SetUnixSocket(path)
+}
+
+// AddDestination adds a destination which receives a copy of every message sent by the default client. See
+// Client.AddDestination.
+func AddDestination(address string, port int) error {
+	return defaultClient.AddDestination(address, port)
+}
+
+// RemoveDestination removes a destination previously added with AddDestination.
+func RemoveDestination(address string, port int) {
+	defaultClient.RemoveDestination(address, port)
+}
 
 // UdpAddress returns the current target UDP address (defaulting to 127.0.0.1).
-func UdpAddress() string { return udpAddress }
+func UdpAddress() string { return defaultClient.UdpAddress() }
 
-// SetUdpAddress sets the current target UDP address.
+// SetUdpAddress sets the current target UDP address, which may be a hostname or an IPv4 or IPv6 address. If
+// the new address cannot be dialed, the failure is logged and the dial is retried when messages are sent.
 func SetUdpAddress(address string) {
-	udpAddress = address
-	establishConn()
+	if err := defaultClient.SetUdpAddress(address); err != nil {
+		log.Printf("hastur: unable to connect to the agent: %s", err)
+	}
 }
 
 // UdpPort returns the current target UDP port (defaulting to 8125).
-func UdpPort() int { return udpPort }
+func UdpPort() int { return defaultClient.UdpPort() }
 
-// SetUdpPort sets the current target UDP port.
+// SetUdpPort sets the current target UDP port. If the new port cannot be dialed, the failure is logged and the
+// dial is retried when messages are sent.
 func SetUdpPort(port int) {
-	udpPort = port
-	establishConn()
+	if err := defaultClient.SetUdpPort(port); err != nil {
+		log.Printf("hastur: unable to connect to the agent: %s", err)
+	}
+}
+
+// Close closes the default client's UDP connection, first writing out any asynchronously queued messages.
+// Messages sent afterwards are discarded until a new address or port is set.
+func Close() error {
+	return defaultClient.Close()
+}
+
+// SetReconnectBackoff sets the delays used by the default client when re-dialing after a failed write. See
+// Client.SetReconnectBackoff.
+func SetReconnectBackoff(min, max time.Duration) {
+	defaultClient.SetReconnectBackoff(min, max)
+}
+
+// SetEncoder sets the encoder the default client uses to convert messages to bytes. See Encoder.
+func SetEncoder(encoder Encoder) {
+	defaultClient.SetEncoder(encoder)
+}
+
+// SetTransport routes the default client's messages through transport instead of its connection. See
+// Client.SetTransport.
+func SetTransport(transport Transport) {
+	defaultClient.SetTransport(transport)
+}
+
+// SetMaxEventSubjectLen sets the length, in bytes, beyond which the default client truncates event subjects.
+func SetMaxEventSubjectLen(max int) {
+	defaultClient.SetMaxEventSubjectLen(max)
+}
+
+// SetMaxEventBodyLen sets the length, in bytes, beyond which the default client truncates event bodies.
+func SetMaxEventBodyLen(max int) {
+	defaultClient.SetMaxEventBodyLen(max)
+}
+
+// SetMaxLogSubjectLen sets the length, in bytes, beyond which the default client truncates log subjects.
+func SetMaxLogSubjectLen(max int) {
+	defaultClient.SetMaxLogSubjectLen(max)
+}
+
+// SetCompression sets the compression the default client applies to large messages. See
+// Client.SetCompression.
+func SetCompression(compression Compression) {
+	defaultClient.SetCompression(compression)
+}
+
+// SetCompressionThreshold sets the size, in bytes, above which the default client compresses messages.
+func SetCompressionThreshold(threshold int) {
+	defaultClient.SetCompressionThreshold(threshold)
+}
+
+// SetDialTimeout bounds how long the default client may spend connecting to the agent. See
+// Client.SetDialTimeout.
+func SetDialTimeout(timeout time.Duration) {
+	defaultClient.SetDialTimeout(timeout)
+}
+
+// SetWriteTimeout bounds how long the default client may spend writing a message. See
+// Client.SetWriteTimeout.
+func SetWriteTimeout(timeout time.Duration) {
+	defaultClient.SetWriteTimeout(timeout)
+}
+
+// SetAsync turns asynchronous sending on or off for the default client. See Client.SetAsync.
+func SetAsync(enabled bool) {
+	defaultClient.SetAsync(enabled)
+}
+
+// SetQueueSize sets the size of the default client's asynchronous send queue. See Client.SetQueueSize.
+func SetQueueSize(size int) {
+	defaultClient.SetQueueSize(size)
+}
+
+// SetQueuePolicy sets the behavior of the default client when its asynchronous send queue is full.
+func SetQueuePolicy(policy QueuePolicy) {
+	defaultClient.SetQueuePolicy(policy)
+}
+
+// Flush blocks until every message queued by the default client has been written.
+func Flush() {
+	defaultClient.Flush()
+}
+
+// SetErrorHandler sets a function to be called whenever the default client fails to send a message. See
+// Client.SetErrorHandler.
+func SetErrorHandler(handler ErrorHandler) {
+	defaultClient.SetErrorHandler(handler)
+}
+
+// DroppedMessages returns the total number of messages the default client has dropped. See
+// Client.DroppedMessagesByReason for a breakdown.
+func DroppedMessages() uint64 {
+	return defaultClient.DroppedMessages()
+}
+
+// DroppedMessagesByReason returns the number of messages the default client has dropped, keyed by reason.
+func DroppedMessagesByReason() map[DropReason]uint64 {
+	return defaultClient.DroppedMessagesByReason()
 }
 
 // AddDefaultLabels adds label key/value pairs to the set of default labels to attach to every message.
 func AddDefaultLabels(labels map[string]interface{}) {
-	for label, value := range labels {
-		defaultLabels[label] = value
-	}
+	defaultClient.AddDefaultLabels(labels)
 }
 
 // RemoveDefaultLabels removes default labels from the default label set that were previously added using
 // AddDefaultLabels. Provide labels to remove by key. This does not do anything if the labels given are not
-// present in the default label list. The builtin default labels ("app" and "pid") cannot be removed.
+// present in the default label list. The builtin default labels ("app", "pid", and "host") cannot be removed,
+// although they may be overridden by adding a label with the same key.
 func RemoveDefaultLabels(labels ...string) {
-	for _, label := range labels {
-		delete(defaultLabels, label)
-	}
+	defaultClient.RemoveDefaultLabels(labels...)
 }
 
-// DefaultLabels returns the current default labels which are attached to every Hastur message. This includes
-// the defaults ("app" and "pid") and any additional labels added with AddDefaultLabels.
-func DefaultLabels() map[string]interface{} {
-	labels := map[string]interface{}{
-		"pid": os.Getpid(),
-		"app": AppName(),
-	}
-	for label, value := range defaultLabels {
-		labels[label] = value
-	}
-	return labels
+// SetDefaultLabel adds a single label to the set of default labels to attach to every message.
+func SetDefaultLabel(key string, value interface{}) {
+	defaultClient.SetDefaultLabel(key, value)
 }
 
-// Merge some extra labels with the default labels and return a new label map.
-func mergeDefaultLabels(labels map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
-	for label, value := range labels {
-		result[label] = value
-	}
-	for label, value := range DefaultLabels() {
-		result[label] = value
-	}
-	return result
+// GetDefaultLabel returns the value of a single default label (including the builtin labels) and whether it is
+// present.
+func GetDefaultLabel(key string) (interface{}, bool) {
+	return defaultClient.GetDefaultLabel(key)
+}
+
+// ClearDefaultLabels removes every default label added with AddDefaultLabels or SetDefaultLabel. The builtin
+// default labels remain.
+func ClearDefaultLabels() {
+	defaultClient.ClearDefaultLabels()
+}
+
+// DefaultLabels returns the current default labels which are attached to every Hastur message. This includes
+// the defaults ("app", "pid", and "host") and any additional labels added with AddDefaultLabels.
+func DefaultLabels() map[string]interface{} {
+	return defaultClient.DefaultLabels()
 }
 
 // AppName returns the current app name as a string. This is chosen, in priority order, from: (a) an app name
-// explicitly set with SetAppName, (b) the environment variable HASTUR_APP_NAME, or (c) the currently running
-// executable.
+// explicitly set with SetAppName, (b) the environment variable HASTUR_APP_NAME, or (c) the file name of the
+// currently running executable, without its directory.
 func AppName() string {
-	if appName != "" {
-		return appName
-	}
-	if name := os.Getenv("HASTUR_APP_NAME"); name != "" {
-		return name
-	}
-	return os.Args[0]
+	return defaultClient.AppName()
 }
 
 // SetAppName sets the current app name that will be attached to each message under the "app" label. This
-// overrides all other sources of choosing an app name.
+// overrides all other sources of choosing an app name. Setting an empty name is the same as ResetAppName.
 func SetAppName(name string) {
-	appName = name
+	defaultClient.SetAppName(name)
 }
 
-// MarkFull is the same as Mark but allows for explicit setting of the timestamp and labels.
-func MarkFull(name, value string, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "mark",
-		"name":      name,
-		"value":     value,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+// ResetAppName clears any app name set with SetAppName, so the app name is once again chosen automatically.
+func ResetAppName() {
+	defaultClient.ResetAppName()
 }
 
-// Mark sends a 'mark' stat to Hastur. A mark gives the time that an interesting event occurred even with no
-// value attached. You can also use a mark to send back string-valued stats that might otherwise be gauges --
-// "Green", "Yellow", "Red" or similar.
-//
-// A mark is different from a Hastur event because it happens at stat priority -- it can be batched or
-// slightly delayed, and doesn't have an end-to-end acknowledgement included.
-func Mark(name, value string) {
-	MarkFull(name, value, time.Now(), make(map[string]interface{}))
+// MarkFull is the same as Mark but allows for explicit setting of the timestamp and labels. The value may be
+// anything which can be marshalled, as with MarkData.
+func MarkFull(name string, value interface{}, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.MarkFull(name, value, timestamp, labels)
+}
+
+// Mark sends a 'mark' stat to Hastur using the default client. See Client.Mark.
+func Mark(name, value string, opts ...Option) {
+	defaultClient.Mark(name, value, opts...)
+}
+
+// MarkData sends a 'mark' stat with a structured value to Hastur using the default client. See
+// Client.MarkData.
+func MarkData(name string, value interface{}, opts ...Option) {
+	defaultClient.MarkData(name, value, opts...)
+}
+
+// SetFull is the same as Set but allows for explicit setting of the timestamp and labels.
+func SetFull(name, value string, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.SetFull(name, value, timestamp, labels)
+}
+
+// Set sends a 'set' stat to Hastur using the default client. See Client.Set.
+func Set(name, value string, opts ...Option) {
+	defaultClient.Set(name, value, opts...)
 }
 
 // CounterFull is the same as Counter but allows for explicit setting of the timestamp and labels.
 func CounterFull(name string, value int, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "counter",
-		"name":      name,
-		"value":     value,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.CounterFull(name, value, timestamp, labels)
+}
+
+// Counter sends a 'counter' stat to Hastur using the default client. See Client.Counter.
+func Counter(name string, value int, opts ...Option) {
+	defaultClient.Counter(name, value, opts...)
+}
+
+// CounterInt64Full is the same as CounterInt64 but allows for explicit setting of the timestamp and labels.
+func CounterInt64Full(name string, value int64, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.CounterInt64Full(name, value, timestamp, labels)
+}
+
+// CounterInt64 sends a 'counter' stat with a 64-bit delta to Hastur using the default client. See
+// Client.CounterInt64.
+func CounterInt64(name string, value int64, opts ...Option) {
+	defaultClient.CounterInt64(name, value, opts...)
+}
+
+// CounterFloatFull is the same as CounterFloat but allows for explicit setting of the timestamp and labels.
+func CounterFloatFull(name string, value float64, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.CounterFloatFull(name, value, timestamp, labels)
+}
+
+// CounterFloat sends a 'counter' stat with a fractional delta to Hastur using the default client. See
+// Client.CounterFloat.
+func CounterFloat(name string, value float64, opts ...Option) {
+	defaultClient.CounterFloat(name, value, opts...)
+}
+
+// Increment adds 1 to a counter using the default client.
+func Increment(name string, opts ...Option) {
+	defaultClient.Increment(name, opts...)
+}
+
+// Decrement subtracts 1 from a counter using the default client.
+func Decrement(name string, opts ...Option) {
+	defaultClient.Decrement(name, opts...)
 }
 
-// Counter sends a 'counter' stat to Hastur. Counters are linear, and are sent as deltas (differences).
-// Sending a value of 1 adds 1 to the counter.
-func Counter(name string, value int) {
-	CounterFull(name, value, time.Now(), make(map[string]interface{}))
+// CounterSampled sends a sampled 'counter' stat to Hastur using the default client. See
+// Client.CounterSampled.
+func CounterSampled(name string, value int, rate float64) {
+	defaultClient.CounterSampled(name, value, rate)
 }
 
 // GaugeFull is the same as Gauge but allows for explicit setting of the timestamp and labels.
 func GaugeFull(name string, value float64, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "gauge",
-		"name":      name,
-		"value":     value,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.GaugeFull(name, value, timestamp, labels)
+}
+
+// Gauge sends a 'gauge' stat to Hastur using the default client. See Client.Gauge.
+func Gauge(name string, value float64, opts ...Option) {
+	defaultClient.Gauge(name, value, opts...)
+}
+
+// GaugeIntFull is the same as GaugeInt but allows for explicit setting of the timestamp and labels.
+func GaugeIntFull(name string, value int, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.GaugeIntFull(name, value, timestamp, labels)
+}
+
+// GaugeInt sends an integer 'gauge' stat to Hastur using the default client. See Client.GaugeInt.
+func GaugeInt(name string, value int, opts ...Option) {
+	defaultClient.GaugeInt(name, value, opts...)
+}
+
+// GaugeSampled sends a sampled 'gauge' stat to Hastur using the default client. See Client.GaugeSampled.
+func GaugeSampled(name string, value float64, rate float64) {
+	defaultClient.GaugeSampled(name, value, rate)
 }
 
-// Gauge sends a 'gauge' stat to Hastur. A gauge's value may or may not be on a linear scale. It is sent as an
-// exact value, not a difference.
-func Gauge(name string, value float64) {
-	GaugeFull(name, value, time.Now(), make(map[string]interface{}))
+// TimerFull is the same as Timer but allows for explicit setting of the timestamp and labels.
+func TimerFull(name string, value float64, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.TimerFull(name, value, timestamp, labels)
+}
+
+// Timer sends a 'timer' stat to Hastur using the default client. See Client.Timer.
+func Timer(name string, value float64, opts ...Option) {
+	defaultClient.Timer(name, value, opts...)
+}
+
+// CompoundFull is the same as Compound but allows for explicit setting of the timestamp and labels.
+func CompoundFull(name string, values map[string]float64, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.CompoundFull(name, values, timestamp, labels)
+}
+
+// Compound sends several related stats as one message using the default client. See Client.Compound.
+func Compound(name string, values map[string]float64, opts ...Option) {
+	defaultClient.Compound(name, values, opts...)
 }
 
 // EventFull is the same as Event but allows for explicit setting of the timestamp and labels.
 func EventFull(name, subject, body string, attn []string, timestamp time.Time, labels map[string]interface{}) {
-	truncatedSubject := subject
-	if len(subject) > 3072 {
-		truncatedSubject = subject[:3072]
-	}
-	truncatedBody := body
-	if len(body) > 3072 {
-		truncatedBody = body[:3072]
-	}
-	message := map[string]interface{}{
-		"type":      "event",
-		"name":      name,
-		"subject":   truncatedSubject,
-		"body":      truncatedBody,
-		"attn":      attn,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.EventFull(name, subject, body, attn, timestamp, labels)
 }
 
-// Event sends an event to Hastur. An event is high-priority and never buffered, and will be sent
-// preferentially to stats or heartbeats. It includes an end-to-end acknowledgement mechanism to ensure
-// arrival, but is expensive to store, send and query.
-//
-// 'attn' is a mechanism to describe the system or component in which the event occurs and who would care
-// about it. Obvious values to include in the array include user logins, email addresses, team names, and
-// server, library or component names. This allows making searches like "what events should I worry about?".
-//
-// The name is the name of the event (e.g., "bad.log.line"). The subject is a subject or message for this
-// specific event. The body can contain additional details -- this could be a stack trace or an email body.
-// "attn" are relevant components or teams. Web hooks or email addresses would go here.
-func Event(name, subject, body string, attn []string) {
-	EventFull(name, subject, body, attn, time.Now(), make(map[string]interface{}))
+// Event sends an event to Hastur using the default client. See Client.Event.
+func Event(name, subject, body string, attn []string, opts ...Option) {
+	defaultClient.Event(name, subject, body, attn, opts...)
 }
 
 // LogFull is the same as Log but allows for explicit setting of the timestamp and labels.
 func LogFull(subject string, data interface{}, timestamp time.Time, labels map[string]interface{}) {
-	truncatedSubject := subject
-	if len(subject) > 7168 {
-		truncatedSubject = subject[:7168]
-	}
-	message := map[string]interface{}{
-		"type":      "log",
-		"subject":   truncatedSubject,
-		"data":      data,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.LogFull(subject, data, timestamp, labels)
 }
 
-// Log sends a log line to Hastur. A log line is of relatively low priority, comparable to stats, and is
-// allowed to be buffered or batched while higher-priority data is sent first.
-//
-// The data values must be convertable to json. Severity can be included in the data field with the tag
-// "severity", if desired.
-func Log(subject string, data interface{}) {
-	LogFull(subject, data, time.Now(), make(map[string]interface{}))
+// Log sends a log line to Hastur using the default client. See Client.Log.
+func Log(subject string, data interface{}, opts ...Option) {
+	defaultClient.Log(subject, data, opts...)
 }
 
-// RegisterProcess sends a process registration to Hastur. This indicates that the process is currently
-// running, and that heartbeats should be sent for some time afterward.
-//
-// The name parameter indicates the name of the app or process, while data is any additional information to
-// include with the registration. The values of data must be convertable to json.
+// RegisterProcess sends a process registration to Hastur using the default client. See
+// Client.RegisterProcess.
 func RegisterProcess(name string, data map[string]interface{}, timestamp time.Time, labels map[string]interface{}) {
-	allData := map[string]interface{}{
-		"name":     name,
-		"language": "go",
-		"version":  Version,
-	}
-	for key, value := range data {
-		allData[key] = value
-	}
-	message := map[string]interface{}{
-		"type":      "reg_process",
-		"data":      allData,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.RegisterProcess(name, data, timestamp, labels)
 }
 
 // InfoProcessFull is the same as InfoProcess but allows for explicit setting of the timestamp and labels.
 func InfoProcessFull(tag string, data map[string]interface{}, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "info_process",
-		"tag":       tag,
-		"data":      data,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.InfoProcessFull(tag, data, timestamp, labels)
 }
 
-// InfoProcess sends freeform process information to Hastur. This can be supplemental information about
-// resources like memory, files open and whatnot. It can be additional configuration or deployment information
-// like environment (dev/staging/prod), software or component version, etc. It can be information about the
-// application as deployed, as run, or as it is currently running.
-//
-// The default labels contain application name and process ID to match this information with the process
-// registration and similar details.
-//
-// Any number of these can be sent as information changes or is superceded. However, if information changes
-// constantly or needs to be graphed or alerted on, send that separately as a metric or event. These messages
-// are freeform and not readily separable or graphable.
-func InfoProcess(tag string, data map[string]interface{}) {
-	InfoProcessFull(tag, data, time.Now(), make(map[string]interface{}))
+// InfoProcess sends freeform process information to Hastur using the default client. See
+// Client.InfoProcess.
+func InfoProcess(tag string, data map[string]interface{}, opts ...Option) {
+	defaultClient.InfoProcess(tag, data, opts...)
 }
 
 // InfoAgentFull is the same as InfoAgent but allows for explicit setting of the timestamp and labels.
 func InfoAgentFull(tag string, data map[string]interface{}, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "info_agent",
-		"tag":       tag,
-		"data":      data,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.InfoAgentFull(tag, data, timestamp, labels)
 }
 
-// InfoAgent sends back freeform data about the agent or host that Hastur is running on. Sample uses include
-// what libraries or packages are installed and available, or the total installed memory.
-//
-// Any number of these can be sent as information changes or is superceded. However, if information changes
-// constantly or needs to be graphed or alerted on, send that separately as a metric or event. These messages
-// are freeform and not readily separable or graphable.
-func InfoAgent(tag string, data map[string]interface{}) {
-	InfoAgentFull(tag, data, time.Now(), make(map[string]interface{}))
+// InfoAgent sends freeform data about the agent or host to Hastur using the default client. See
+// Client.InfoAgent.
+func InfoAgent(tag string, data map[string]interface{}, opts ...Option) {
+	defaultClient.InfoAgent(tag, data, opts...)
 }
 
 // HeartbeatFull is the same as Heartbeat but allows for explicit setting of the timestamp and labels.
 func HeartbeatFull(name string, value, timeout float64, timestamp time.Time, labels map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":      "hb_process",
-		"name":      name,
-		"value":     value,
-		"timeout":   timeout,
-		"timestamp": convertTime(timestamp),
-		"labels":    mergeDefaultLabels(labels),
-	}
-	send(message)
+	defaultClient.HeartbeatFull(name, value, timeout, timestamp, labels)
 }
 
-// Heartbeat sends a heartbeat to Hastur. A heartbeat is a periodic message which indicates that a host,
-// application or service is currently running. It is higher priority than a statistic and should not be
-// batched, but is lower priority than an event and does not include an end-to-end acknowledgement.
-func Heartbeat() {
-	HeartbeatFull("application.heartbeat", 0, 0, time.Now(), make(map[string]interface{}))
+// Heartbeat sends a heartbeat to Hastur using the default client. See Client.Heartbeat.
+func Heartbeat(opts ...Option) {
+	defaultClient.Heartbeat(opts...)
 }
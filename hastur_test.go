@@ -2,14 +2,32 @@ package hastur_test
 
 import (
 	"git.corp.ooyala.com/hastur-go"
+	"git.corp.ooyala.com/hastur-go/hasturtest"
 
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	. "launchpad.net/gocheck"
 	"log"
+	"log/slog"
+	"math"
+	"math/big"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -116,6 +134,8 @@ func VerifyCommonAttributes(c *C, m Message) {
 	labels := GetLabels(c, m)
 	c.Check(labels["app"], Equals, "test.app")
 	c.Check(labels["pid"], Equals, float64(os.Getpid())) // json recovers all numbers as float64
+	hostname, _ := os.Hostname()
+	c.Check(labels["host"], Equals, hostname)
 }
 
 // Check that the timestamp is present and is set to a recent value (as it should be if the default timestamp
@@ -165,6 +185,60 @@ func (s *HasturSuite) TestCounter(c *C) {
 	c.Check(m["value"], Equals, 10.0)
 }
 
+func (s *HasturSuite) TestIncrementDecrement(c *C) {
+	hastur.Increment("test.counter")
+	hastur.Decrement("test.counter")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "counter")
+	c.Check(messages[0]["value"], Equals, 1.0)
+	c.Check(messages[1]["type"], Equals, "counter")
+	c.Check(messages[1]["value"], Equals, -1.0)
+}
+
+func (s *HasturSuite) TestSampled(c *C) {
+	for i := 0; i < 10; i++ {
+		hastur.CounterSampled("test.counter", 1, 0)
+		hastur.GaugeSampled("test.gauge", 1.0, 0)
+	}
+	hastur.CounterSampled("test.counter", 2, 1.0)
+	hastur.GaugeSampled("test.gauge", 2.0, 0.99999999)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "counter")
+	c.Check(messages[0]["value"], Equals, 2.0)
+	_, ok := messages[0]["sample_rate"]
+	c.Check(ok, Equals, false)
+	c.Check(messages[1]["type"], Equals, "gauge")
+	c.Check(messages[1]["value"], Equals, 2.0)
+	c.Check(messages[1]["sample_rate"], Equals, 0.99999999)
+	VerifyCommonAttributes(c, messages[1])
+}
+
+func (s *HasturSuite) TestTimeSampled(c *C) {
+	runs := 0
+	for i := 0; i < 10; i++ {
+		hastur.TimeSampled(func() { runs++ }, "test.time", 0)
+	}
+	c.Check(runs, Equals, 10)
+	hastur.TimeSampled(func() { runs++ }, "test.time", 0.99999999)
+	hastur.SetReportTimers(true)
+	defer hastur.SetReportTimers(false)
+	hastur.TimeSampled(func() { runs++ }, "test.time", 0.99999999)
+	c.Check(runs, Equals, 12)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "gauge")
+	c.Check(messages[0]["name"], Equals, "test.time")
+	c.Check(messages[0]["sample_rate"], Equals, 0.99999999)
+	c.Check(messages[1]["type"], Equals, "timer")
+	c.Check(messages[1]["sample_rate"], Equals, 0.99999999)
+	VerifyCommonAttributes(c, messages[1])
+}
+
 func (s *HasturSuite) TestGauge(c *C) {
 	hastur.Gauge("test.gauge", 1.234)
 	m := GetAndVerifySingleMessage(c)
@@ -174,6 +248,85 @@ func (s *HasturSuite) TestGauge(c *C) {
 	c.Check(m["value"], Equals, 1.234)
 }
 
+func (s *HasturSuite) TestTimer(c *C) {
+	hastur.Timer("test.timer", 0.25)
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "timer")
+	c.Check(m["name"], Equals, "test.timer")
+	c.Check(m["value"], Equals, 0.25)
+}
+
+func (s *HasturSuite) TestTimeCurrentFull(c *C) {
+	func() {
+		defer hastur.TimeCurrentFull("test.time", time.Now(), map[string]interface{}{"route": "/status"})
+	}()
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "gauge")
+	c.Check(m["name"], Equals, "test.time")
+	c.Check(GetLabels(c, m)["route"], Equals, "/status")
+}
+
+func (s *HasturSuite) TestTimeAsTimer(c *C) {
+	hastur.Time(func() {}, "test.time")
+	hastur.SetReportTimers(true)
+	hastur.Time(func() {}, "test.time")
+	hastur.TimeCurrent("test.time", time.Now())
+	hastur.SetReportTimers(false)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	for i, expected := range []string{"gauge", "timer", "timer"} {
+		c.Check(messages[i]["type"], Equals, expected)
+		c.Check(messages[i]["name"], Equals, "test.time")
+	}
+}
+
+func (s *HasturSuite) TestTimeErr(c *C) {
+	failure := errors.New("failure")
+	c.Check(hastur.TimeErr(func() error { return nil }, "test.time"), IsNil)
+	c.Check(hastur.TimeErr(func() error { return failure }, "test.time"), Equals, failure)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	for i, expected := range []bool{false, true} {
+		c.Check(messages[i]["type"], Equals, "gauge")
+		c.Check(GetLabels(c, messages[i])["error"], Equals, expected)
+	}
+}
+
+func (s *HasturSuite) TestTimeValue(c *C) {
+	failure := errors.New("failure")
+	c.Check(hastur.TimeValue("test.time", func() int { return 42 }), Equals, 42)
+	value, err := hastur.TimeValueErr("test.time", func() (string, error) { return "partial", failure })
+	c.Check(value, Equals, "partial")
+	c.Check(err, Equals, failure)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["name"], Equals, "test.time")
+	c.Check(messages[0]["type"], Equals, "gauge")
+	c.Check(GetLabels(c, messages[1])["error"], Equals, true)
+}
+
+func (s *HasturSuite) TestMarkData(c *C) {
+	hastur.MarkData("test.mark", map[string]interface{}{"status": "degraded", "replicas": 2})
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "mark")
+	c.Check(m["value"], DeepEquals, map[string]interface{}{"status": "degraded", "replicas": float64(2)})
+}
+
+func (s *HasturSuite) TestSet(c *C) {
+	hastur.Set("test.users", "user-42")
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "set")
+	c.Check(m["name"], Equals, "test.users")
+	c.Check(m["value"], Equals, "user-42")
+}
+
 func (s *HasturSuite) TestEvent(c *C) {
 	hastur.Event("test.event", "hey", "there", []string{"foo@bar.com"})
 	m := GetAndVerifySingleMessage(c)
@@ -183,6 +336,18 @@ func (s *HasturSuite) TestEvent(c *C) {
 	c.Check(m["subject"], Equals, "hey")
 	c.Check(m["body"], Equals, "there")
 	c.Check(m["attn"], DeepEquals, []interface{}{"foo@bar.com"})
+	c.Check(m["id"], Matches, "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}")
+}
+
+func (s *HasturSuite) TestEventWithID(c *C) {
+	first := hastur.EventWithID("test.event", "hey", "there", []string{})
+	second := hastur.EventWithID("test.event", "hey", "again", []string{})
+	c.Check(first, Not(Equals), second)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["id"], Equals, first)
+	c.Check(messages[1]["id"], Equals, second)
 }
 
 func (s *HasturSuite) TestLog(c *C) {
@@ -213,6 +378,19 @@ func (s *HasturSuite) TestRegisterProcess(c *C) {
 	c.Check(data["name"], Equals, "test.process")
 	c.Check(data["language"], Equals, "go")
 	c.Check(data["haz"], Equals, "data")
+	c.Check(data["go_version"], Equals, runtime.Version())
+	c.Check(data["num_cpu"], Equals, float64(runtime.NumCPU()))
+	c.Check(data["start_time"], NotNil)
+}
+
+func (s *HasturSuite) TestRegisterProcessOverrides(c *C) {
+	hastur.RegisterProcess("test.process", map[string]interface{}{"go_version": "custom"}, time.Now(),
+		make(map[string]interface{}))
+	m := GetAndVerifySingleMessage(c)
+
+	data, ok := m["data"].(map[string]interface{})
+	c.Assert(ok, Equals, true)
+	c.Check(data["go_version"], Equals, "custom")
 }
 
 func (s *HasturSuite) TestInfoProcess(c *C) {
@@ -254,6 +432,95 @@ func (s *HasturSuite) TestLogOnError(c *C) {
 	c.Check(m["subject"], Matches, ".*unsupported type.*")
 }
 
+func (s *HasturSuite) TestClientReturnsMarshalError(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetAppName("test.app")
+	err = client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+	c.Check(err, NotNil)
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "log")
+}
+
+func (s *HasturSuite) TestEncoder(c *C) {
+	hastur.SetEncoder(hastur.EncoderFunc(func(message interface{}) ([]byte, error) {
+		bytes, err := json.Marshal(message)
+		return append([]byte(`{"encoded":true,`), bytes[1:]...), err
+	}))
+	hastur.Mark("test.mark", "foo")
+	hastur.SetEncoder(nil)
+	hastur.Mark("test.mark", "foo")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["encoded"], Equals, true)
+	c.Check(messages[0]["value"], Equals, "foo")
+	_, ok := messages[1]["encoded"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *HasturSuite) TestPrefix(c *C) {
+	hastur.SetPrefix("billing")
+	c.Check(hastur.Prefix(), Equals, "billing")
+	hastur.Counter("requests.total", 1)
+	hastur.Event("failure", "subject", "body", []string{})
+	hastur.Log("not named", "")
+	hastur.SetPrefixSeparator("/")
+	hastur.Gauge("queue", 1)
+	hastur.SetPrefixSeparator(".")
+	hastur.SetPrefix("")
+	hastur.Mark("plain", "")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 5)
+	c.Check(messages[0]["name"], Equals, "billing.requests.total")
+	c.Check(messages[1]["name"], Equals, "billing.failure")
+	c.Check(messages[2]["subject"], Equals, "not named")
+	c.Check(messages[3]["name"], Equals, "billing/queue")
+	c.Check(messages[4]["name"], Equals, "plain")
+}
+
+func (s *HasturSuite) TestNameSanitizing(c *C) {
+	names := map[string]string{
+		"valid.name_1-2": "valid.name_1-2",
+		"has space":      "has_space",
+		"new\nline":      "new_line",
+		`quote"brace}`:   "quote_brace_",
+		"caf\u00e9":      "caf_",
+		"":               "_",
+	}
+	for name := range names {
+		hastur.Counter(name, 1)
+	}
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, len(names))
+	sanitized := make(map[string]bool)
+	for _, m := range messages {
+		sanitized[m["name"].(string)] = true
+	}
+	for _, expected := range names {
+		c.Check(sanitized[expected], Equals, true)
+	}
+}
+
+func (s *HasturSuite) TestStrictNames(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetStrictNames(true)
+	client.SetPrefix("prefix with space")
+	err = client.Counter("bad name", 1)
+	c.Check(errors.Is(err, hastur.ErrInvalidName), Equals, true)
+	c.Check(client.Counter("", 1), NotNil)
+	c.Check(client.Counter("good.name", 1), IsNil)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["name"], Equals, "prefix with space.good.name")
+}
+
 func (s *HasturSuite) TestDefaultLabels(c *C) {
 	hastur.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"label1": "value1"})
 	hastur.AddDefaultLabels(map[string]interface{}{"label2": "value2"})
@@ -279,9 +546,144 @@ func (s *HasturSuite) TestDefaultLabels(c *C) {
 	c.Check(ok, Equals, false)
 }
 
+func (s *HasturSuite) TestSingleDefaultLabel(c *C) {
+	hastur.SetDefaultLabel("label1", "value1")
+	hastur.SetDefaultLabel("label2", "value2")
+	value, ok := hastur.GetDefaultLabel("label1")
+	c.Check(ok, Equals, true)
+	c.Check(value, Equals, "value1")
+	value, ok = hastur.GetDefaultLabel("app")
+	c.Check(ok, Equals, true)
+	c.Check(value, Equals, "test.app")
+	hastur.Mark("test.mark", "foo")
+	hastur.ClearDefaultLabels()
+	_, ok = hastur.GetDefaultLabel("label2")
+	c.Check(ok, Equals, false)
+	hastur.Mark("test.mark", "foo")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(GetLabels(c, messages[0])["label2"], Equals, "value2")
+	_, ok = GetLabels(c, messages[1])["label2"]
+	c.Check(ok, Equals, false)
+	VerifyCommonAttributes(c, messages[1])
+}
+
+func (s *HasturSuite) TestDefaultLabelsCopy(c *C) {
+	labels := hastur.DefaultLabels()
+	labels["label3"] = "value3"
+	_, ok := hastur.DefaultLabels()["label3"]
+	c.Check(ok, Equals, false)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestDefaultLabelsConcurrent(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			client.AddDefaultLabels(map[string]interface{}{fmt.Sprintf("label%d", i): i})
+			client.RemoveDefaultLabels("label0")
+		}
+		done <- true
+	}()
+	for i := 0; i < 10; i++ {
+		client.Counter("test.counter", 1)
+	}
+	<-done
+
+	messages := FinishCapture()
+	c.Check(messages, HasLen, 10)
+	_, ok := client.DefaultLabels()["label9"]
+	c.Check(ok, Equals, true)
+}
+
+func (s *HasturSuite) TestAppNameConcurrent(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	names := map[interface{}]bool{"app.one": true, "app.two": true}
+	client.SetAppName("app.one")
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				done <- true
+				return
+			default:
+			}
+			if i%2 == 0 {
+				client.SetAppName("app.two")
+			} else {
+				client.SetAppName("app.one")
+			}
+		}
+	}()
+	const senders, sends = 4, 100
+	sent := make(chan bool)
+	for i := 0; i < senders; i++ {
+		go func() {
+			for j := 0; j < sends; j++ {
+				client.Counter("test.counter", 1)
+			}
+			sent <- true
+		}()
+	}
+	for i := 0; i < senders; i++ {
+		<-sent
+	}
+	close(stop)
+	<-done
+
+	messages := recorder.Messages()
+	c.Check(messages, HasLen, senders*sends)
+	for _, message := range messages {
+		c.Check(names[message["labels"].(map[string]interface{})["app"]], Equals, true)
+	}
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestReconfigureConcurrent(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			c.Check(client.SetUdpPort(testPort), IsNil)
+		}
+		done <- true
+	}()
+	for i := 0; i < 10; i++ {
+		c.Check(client.Counter("test.counter", 1), IsNil)
+	}
+	<-done
+
+	messages := FinishCapture()
+	c.Check(messages, HasLen, 10)
+}
+
+func (s *HasturSuite) TestHostLabel(c *C) {
+	hastur.RemoveDefaultLabels("host")
+	hastur.Mark("test.mark", "foo")
+	hastur.AddDefaultLabels(map[string]interface{}{"host": "other.host"})
+	hastur.Mark("test.mark", "foo")
+	hastur.RemoveDefaultLabels("host")
+	hastur.Mark("test.mark", "foo")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	VerifyCommonAttributes(c, messages[0])
+	c.Check(GetLabels(c, messages[1])["host"], Equals, "other.host")
+	VerifyCommonAttributes(c, messages[2])
+}
+
 func (s *HasturSuite) TestAppName(c *C) {
-	hastur.SetAppName("")
 	os.Setenv("HASTUR_APP_NAME", "env.name")
+	hastur.ResetAppName()
 	hastur.Mark("foo", "bar")
 	hastur.SetAppName("real.name")
 	hastur.Mark("foo", "bar")
@@ -297,4 +699,2097 @@ func (s *HasturSuite) TestAppName(c *C) {
 
 	c.Check(names[0], Equals, "env.name")
 	c.Check(names[1], Equals, "real.name")
+	hastur.ResetAppName()
+	c.Check(hastur.AppName(), Equals, "env.name")
+}
+
+func (s *HasturSuite) TestAppNameReadOnReset(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	os.Setenv("HASTUR_APP_NAME", "before")
+	client.ResetAppName()
+	os.Setenv("HASTUR_APP_NAME", "after")
+	client.Mark("foo", "bar")
+	c.Check(client.AppName(), Equals, "before")
+	client.ResetAppName()
+	client.Mark("foo", "bar")
+	c.Check(client.AppName(), Equals, "after")
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["labels"].(map[string]interface{})["app"], Equals, "before")
+	c.Check(messages[1]["labels"].(map[string]interface{})["app"], Equals, "after")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestAppNameIgnoresDefaultLabel(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.AddDefaultLabels(map[string]interface{}{"app": 5})
+	client.SetAppName("real.name")
+	c.Check(client.AppName(), Equals, "real.name")
+	client.Mark("foo", "bar")
+	c.Assert(recorder.Messages(), HasLen, 1)
+	c.Check(recorder.Messages()[0]["labels"].(map[string]interface{})["app"], Equals, float64(5))
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestAppNameFromExecutable(c *C) {
+	defer os.Setenv("HASTUR_APP_NAME", os.Getenv("HASTUR_APP_NAME"))
+	defer func(arg string) { os.Args[0] = arg }(os.Args[0])
+	os.Unsetenv("HASTUR_APP_NAME")
+	os.Args[0] = "/tmp/go-build123/exe/server"
+	hastur.ResetAppName()
+	c.Check(hastur.AppName(), Equals, "server")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestClient(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetAppName("other.app")
+	client.AddDefaultLabels(map[string]interface{}{"client": "other"})
+	client.Counter("test.counter", 1)
+	hastur.Counter("test.counter", 2)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+
+	labels := GetLabels(c, messages[0])
+	c.Check(labels["app"], Equals, "other.app")
+	c.Check(labels["client"], Equals, "other")
+	c.Check(messages[0]["value"], Equals, 1.0)
+	VerifyCommonAttributes(c, messages[1])
+	_, ok := GetLabels(c, messages[1])["client"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *HasturSuite) TestClose(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	c.Check(client.Mark("test.mark", "open"), IsNil)
+	c.Check(client.Close(), IsNil)
+	c.Check(client.Mark("test.mark", "closed"), Equals, hastur.ErrClosed)
+	c.Check(client.Close(), IsNil)
+	c.Assert(client.SetUdpPort(testPort), IsNil)
+	client.Mark("test.mark", "reopened")
+	client.Close()
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["value"], Equals, "open")
+	c.Check(messages[1]["value"], Equals, "reopened")
+}
+
+func (s *HasturSuite) TestStartAndStopHeartbeat(c *C) {
+	hastur.Start()
+	hastur.StopHeartbeat()
+	hastur.StopHeartbeat()
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "reg_process")
+}
+
+func (s *HasturSuite) TestEveryDuration(c *C) {
+	ticks := make(chan bool, 100)
+	stopper := hastur.EveryDuration(10*time.Millisecond, func() { ticks <- true })
+	<-ticks
+	<-ticks
+	stopper.Stop()
+	time.Sleep(30 * time.Millisecond)
+	count := len(ticks)
+	time.Sleep(30 * time.Millisecond)
+	c.Check(len(ticks), Equals, count)
+
+	c.Check(func() { hastur.EveryDuration(0, func() {}) }, Panics, "EveryDuration called with non-positive duration 0s.")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEveryImmediate(c *C) {
+	ticks := make(chan bool, 1)
+	stopper := hastur.EveryImmediate(hastur.Day, func() { ticks <- true })
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		c.Error("callback was not run immediately")
+	}
+	stopper.Stop()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEveryJittered(c *C) {
+	ticks := make(chan time.Time, 100)
+	start := time.Now()
+	stopper := hastur.EveryJittered(20*time.Millisecond, 0.5, func() { ticks <- time.Now() })
+	first := <-ticks
+	<-ticks
+	stopper.Stop()
+	c.Check(first.Sub(start) >= 10*time.Millisecond, Equals, true)
+
+	c.Check(func() { hastur.EveryJittered(time.Second, 2, func() {}) }, Panics,
+		"EveryJittered called with jitter 2 outside [0, 1].")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestStartContext(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hastur.StartContext(ctx)
+	cancel()
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "reg_process")
+	hastur.StopHeartbeat()
+}
+
+func (s *HasturSuite) TestStartFlushesRegistration(c *C) {
+	transport := &hastur.MemoryTransport{}
+	hastur.SetTransport(transport)
+	defer hastur.SetTransport(nil)
+	hastur.SetAsync(true)
+	defer hastur.SetAsync(false)
+	hastur.Start()
+	hastur.StopHeartbeat()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 1)
+	c.Check(string(sent[0]), Matches, `.*"type":"reg_process".*`)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestAsync(c *C) {
+	hastur.SetAsync(true)
+	for i := 0; i < 5; i++ {
+		hastur.Counter("test.counter", i)
+	}
+	hastur.Flush()
+	hastur.Gauge("test.gauge", 1.0)
+	hastur.SetAsync(false)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 6)
+	for i := 0; i < 5; i++ {
+		c.Check(messages[i]["value"], Equals, float64(i))
+	}
+	c.Check(messages[5]["type"], Equals, "gauge")
+}
+
+func (s *HasturSuite) TestAsyncDropWhenFull(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetQueueSize(0)
+	client.SetAsync(true)
+	c.Check(client.Async(), Equals, true)
+	// With an unbuffered queue, a send only succeeds if the worker happens to be waiting for it, so send until
+	// one is dropped.
+	var dropped error
+	for i := 0; i < 1000 && dropped == nil; i++ {
+		dropped = client.Counter("test.counter", 1)
+	}
+	c.Check(dropped, Equals, hastur.ErrQueueFull)
+
+	client.SetQueuePolicy(hastur.BlockWhenFull)
+	c.Check(client.Counter("test.counter", 1), IsNil)
+	c.Check(client.Close(), IsNil)
+	c.Check(client.Async(), Equals, false)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestReconnect(c *C) {
+	// Find a port with nothing listening on it.
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	c.Assert(err, IsNil)
+	deadAddr := listener.LocalAddr().(*net.UDPAddr)
+	listener.Close()
+
+	client, err := hastur.NewClient("127.0.0.1", deadAddr.Port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetReconnectBackoff(time.Millisecond, 10*time.Millisecond)
+	// Writes to a connected UDP socket fail once the destination has reported that nothing is listening.
+	var writeErr error
+	for i := 0; i < 100 && writeErr == nil; i++ {
+		writeErr = client.Mark("test.mark", "lost")
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(writeErr, NotNil)
+
+	listener, err = net.ListenUDP("udp", deadAddr)
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	time.Sleep(20 * time.Millisecond)
+	c.Check(client.Mark("test.mark", "found"), IsNil)
+	bytes := make([]byte, 1024)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := listener.Read(bytes)
+	c.Assert(err, IsNil)
+	c.Check(string(bytes[:n]), Matches, `.*"value":"found".*`)
+	c.Check(client.Snapshot().Reconnects > 0, Equals, true)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTCP(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	received := make(chan []string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer conn.Close()
+		lines := make([]string, 0)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	client, err := hastur.NewClientWithNetwork("tcp", "127.0.0.1", port)
+	c.Assert(err, IsNil)
+	c.Check(client.Network(), Equals, "tcp")
+	c.Check(client.Mark("test.mark", "one"), IsNil)
+	c.Check(client.Mark("test.mark", "two\nlines"), IsNil)
+	client.Close()
+
+	lines := <-received
+	c.Assert(lines, HasLen, 2)
+	for i, value := range []string{"one", "two\nlines"} {
+		message := make(Message)
+		c.Assert(json.Unmarshal([]byte(lines[i]), &message), IsNil)
+		c.Check(message["value"], Equals, value)
+	}
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestUnixSocket(c *C) {
+	path := filepath.Join(c.MkDir(), "hastur.sock")
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	c.Check(client.SetUnixSocket(path), NotNil)
+	c.Check(client.Network(), Equals, "udp")
+	c.Check(client.Mark("test.mark", "udp"), IsNil)
+
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	c.Assert(client.SetUnixSocket(path), IsNil)
+	c.Check(client.UnixSocket(), Equals, path)
+	c.Check(client.Mark("test.mark", "unix"), IsNil)
+	bytes := make([]byte, 1024)
+	n, err := listener.Read(bytes)
+	c.Assert(err, IsNil)
+	c.Check(string(bytes[:n]), Matches, `.*"value":"unix".*`)
+	c.Check(client.AddDestination("127.0.0.1", testPort), Equals, hastur.ErrDestinationUnsupported)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "udp")
+}
+
+func (s *HasturSuite) TestCompression(c *C) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	client, err := hastur.NewClient("127.0.0.1", listener.LocalAddr().(*net.UDPAddr).Port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetCompression(hastur.Gzip)
+	client.SetCompressionThreshold(100)
+	largeData := strings.Repeat("stack frame\n", 100)
+	c.Check(client.Log("small", ""), IsNil)
+	c.Check(client.Log("large", largeData), IsNil)
+
+	buffer := make([]byte, 65536)
+	n, err := listener.Read(buffer)
+	c.Assert(err, IsNil)
+	c.Check(buffer[0], Equals, byte('{'))
+
+	n, err = listener.Read(buffer)
+	c.Assert(err, IsNil)
+	c.Assert(buffer[0], Equals, hastur.GzipMarker)
+	c.Check(n < len(largeData), Equals, true)
+	reader, err := gzip.NewReader(bytes.NewReader(buffer[1:n]))
+	c.Assert(err, IsNil)
+	message := make(Message)
+	c.Assert(json.NewDecoder(reader).Decode(&message), IsNil)
+	c.Check(message["subject"], Equals, "large")
+	c.Check(message["data"], Equals, largeData)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestFakeClock(c *C) {
+	now := time.Date(2013, 1, 2, 3, 4, 5, 6000, time.UTC)
+	clock := hastur.NewFakeClock(now)
+	defer hastur.SetClock(nil, clock)()
+	hastur.Time(func() { clock.Advance(1500 * time.Millisecond) }, "test.time")
+	hastur.Counter("test.counter", 1)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["value"], Equals, 1.5)
+	c.Check(messages[0]["timestamp"], Equals, float64(now.UnixNano()/1000))
+	c.Check(messages[1]["timestamp"], Equals, float64(now.Add(1500*time.Millisecond).UnixNano()/1000))
+}
+
+func (s *HasturSuite) TestDialFailure(c *C) {
+	_, err := hastur.NewClient("no such host.invalid", testPort)
+	c.Check(err, NotNil)
+
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	c.Check(client.SetUdpAddress("no such host.invalid"), NotNil)
+	c.Check(client.Mark("test.mark", "lost"), Equals, hastur.ErrNotConnected)
+	c.Check(client.SetUdpAddress("127.0.0.1"), IsNil)
+	c.Check(client.Mark("test.mark", "found"), IsNil)
+
+	// The package-level functions never panic on dial failures.
+	hastur.SetUdpAddress("no such host.invalid")
+	hastur.Mark("test.mark", "lost")
+	hastur.SetUdpAddress("127.0.0.1")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "found")
+}
+
+func (s *HasturSuite) TestDroppedMessages(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+	client.Log("large", strings.Repeat("x", 70000))
+	client.SetStrictNames(true)
+	client.Counter("bad name", 1)
+	client.Close()
+	client.Counter("test.counter", 1)
+	client.Counter("test.counter", 1)
+
+	c.Check(client.DroppedMessages(), Equals, uint64(5))
+	c.Check(client.DroppedMessagesByReason(), DeepEquals, map[hastur.DropReason]uint64{
+		hastur.DropMarshalError: 1,
+		hastur.DropTooLarge:     1,
+		hastur.DropInvalidName:  1,
+		hastur.DropClosed:       2,
+	})
+	c.Check(hastur.DropQueueFull.String(), Equals, "queue_full")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestErrorHandler(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	var handled []string
+	client.SetErrorHandler(func(err error, messageType string) {
+		handled = append(handled, messageType)
+		// Sending from the handler must not recurse, even when the send fails.
+		client.Counter("test.errors", 1)
+		client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+	})
+	err = client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+	var marshalErr *hastur.MarshalError
+	c.Check(errors.As(err, &marshalErr), Equals, true)
+	client.Close()
+	client.Gauge("test.gauge", 1)
+	c.Check(handled, DeepEquals, []string{"mark", "gauge"})
+	client.SetErrorHandler(nil)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["name"], Equals, "test.errors")
+}
+
+// A transport whose sends always fail.
+type failingTransport struct{}
+
+func (failingTransport) Send(message []byte) error { return errors.New("unavailable") }
+
+func (s *HasturSuite) TestErrorHandlerConcurrent(c *C) {
+	client := hastur.NewClientWithTransport(failingTransport{})
+	defer client.Close()
+	const senders = 10
+	entered := make(chan bool, 2*senders)
+	release := make(chan bool)
+	client.SetErrorHandler(func(err error, messageType string) {
+		entered <- true
+		<-release
+		// This send fails too, but from inside the handler, so it must not reach the handler.
+		client.Counter("test.errors", 1)
+	})
+	for i := 0; i < senders; i++ {
+		go client.Counter("test.counter", i)
+	}
+	// Every failure reaches the handler while the others are still inside it.
+	for i := 0; i < senders; i++ {
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			c.Fatalf("only %d of %d failures reached the handler", i, senders)
+		}
+	}
+	close(release)
+
+	client.SetAsync(true)
+	for i := 0; i < senders; i++ {
+		c.Check(client.Counter("test.counter", i), IsNil)
+	}
+	client.Flush()
+	for i := 0; i < senders; i++ {
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			c.Fatalf("only %d of %d asynchronous failures reached the handler", i, senders)
+		}
+	}
+	client.Flush()
+	time.Sleep(10 * time.Millisecond)
+	c.Check(entered, HasLen, 0)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestDestinations(c *C) {
+	mirror, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	c.Assert(err, IsNil)
+	defer mirror.Close()
+	mirrorPort := mirror.LocalAddr().(*net.UDPAddr).Port
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	c.Assert(client.AddDestination("127.0.0.1", mirrorPort), IsNil)
+	c.Check(client.Mark("test.mark", "both"), IsNil)
+	client.RemoveDestination("127.0.0.1", mirrorPort)
+	c.Check(client.Mark("test.mark", "main"), IsNil)
+
+	buffer := make([]byte, 1024)
+	n, err := mirror.Read(buffer)
+	c.Assert(err, IsNil)
+	c.Check(string(buffer[:n]), Matches, `.*"value":"both".*`)
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["value"], Equals, "both")
+	c.Check(messages[1]["value"], Equals, "main")
+}
+
+func (s *HasturSuite) TestDestinationsPartialFailure(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	c.Check(client.SetUdpAddress("no such host.invalid"), NotNil)
+	c.Assert(client.AddDestination("127.0.0.1", testPort), IsNil)
+	c.Check(client.Mark("test.mark", "mirrored"), Equals, hastur.ErrNotConnected)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "mirrored")
+}
+
+func (s *HasturSuite) TestIPv6Address(c *C) {
+	listener, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		FinishCapture()
+		c.Skip("IPv6 is not available")
+	}
+	defer listener.Close()
+	client, err := hastur.NewClient("127.0.0.1", listener.LocalAddr().(*net.UDPAddr).Port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	c.Assert(client.SetUdpAddress("::1"), IsNil)
+	c.Check(client.Mark("test.mark", "ipv6"), IsNil)
+
+	buffer := make([]byte, 1024)
+	n, err := listener.Read(buffer)
+	c.Assert(err, IsNil)
+	c.Check(string(buffer[:n]), Matches, `.*"value":"ipv6".*`)
+
+	hastur.SetUdpAddress("::1")
+	hastur.Mark("test.mark", "default client")
+	hastur.SetUdpAddress("127.0.0.1")
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "default client")
+}
+
+func (s *HasturSuite) TestWriteTimeout(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		// Accept the connection but never read from it, so writes eventually block.
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	client, err := hastur.NewClientWithNetwork("tcp", "127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetWriteTimeout(10 * time.Millisecond)
+	data := strings.Repeat("x", 60000)
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = client.Log("blocked", data)
+	}
+	c.Check(err, NotNil)
+	c.Check(client.DroppedMessagesByReason()[hastur.DropWriteError] > 0, Equals, true)
+	client.SetWriteTimeout(0)
+	(<-accepted).Close()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestMemoryTransport(c *C) {
+	transport := &hastur.MemoryTransport{}
+	hastur.SetTransport(transport)
+	hastur.Counter("test.counter", 2)
+	hastur.Mark("test.mark", "foo")
+	hastur.SetTransport(nil)
+	hastur.Mark("test.mark", "bar")
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 2)
+	var message map[string]interface{}
+	c.Assert(json.Unmarshal(sent[0], &message), IsNil)
+	c.Check(message["type"], Equals, "counter")
+	c.Check(message["value"], Equals, float64(2))
+	c.Assert(json.Unmarshal(sent[1], &message), IsNil)
+	c.Check(message["value"], Equals, "foo")
+	transport.Reset()
+	c.Check(transport.Messages(), HasLen, 0)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "bar")
+}
+
+func (s *HasturSuite) TestNewClientWithTransport(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client := hastur.NewClientWithTransport(transport)
+	defer client.Close()
+	c.Check(client.Mark("test.mark", "memory"), IsNil)
+	c.Assert(transport.Messages(), HasLen, 1)
+	c.Check(string(transport.Messages()[0]), Matches, `.*"value":"memory".*`)
+	client.SetTransport(nil)
+	c.Check(client.Mark("test.mark", "network"), Equals, hastur.ErrNotConnected)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestGaugeInt(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	c.Check(client.GaugeInt("test.gauge", 5), IsNil)
+	c.Check(client.GaugeIntFull("test.gauge", -3, time.Now(), map[string]interface{}{"a": 1}), IsNil)
+	client.Close()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 2)
+	c.Check(string(sent[0]), Matches, `.*"value":5[,}].*`)
+	c.Check(string(sent[1]), Matches, `.*"value":-3[,}].*`)
+	var message map[string]interface{}
+	c.Assert(json.Unmarshal(sent[0], &message), IsNil)
+	c.Check(message["type"], Equals, "gauge")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestOptions(c *C) {
+	timestamp := time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC)
+	hastur.Counter("test.counter", 3, hastur.WithLabels(map[string]interface{}{"region": "us"}),
+		hastur.WithLabels(map[string]interface{}{"zone": "a"}))
+	hastur.Mark("test.mark", "foo", hastur.WithTimestamp(timestamp))
+	hastur.Increment("test.counter", hastur.WithLabels(map[string]interface{}{"region": "eu"}))
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	c.Check(messages[0]["value"], Equals, float64(3))
+	c.Check(GetLabels(c, messages[0])["region"], Equals, "us")
+	c.Check(GetLabels(c, messages[0])["zone"], Equals, "a")
+	c.Check(messages[1]["timestamp"], Equals, float64(timestamp.UnixNano()/1000))
+	c.Check(messages[2]["value"], Equals, float64(1))
+	c.Check(GetLabels(c, messages[2])["region"], Equals, "eu")
+}
+
+func (s *HasturSuite) TestShutdown(c *C) {
+	hastur.SetAsync(true)
+	hastur.Mark("test.mark", "last")
+	c.Check(hastur.Shutdown(context.Background()), IsNil)
+	c.Check(hastur.Shutdown(context.Background()), IsNil)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["name"], Equals, "test.mark")
+	c.Check(messages[1]["name"], Equals, "process_stopping")
+}
+
+func (s *HasturSuite) TestDrainAndClose(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	client.SetAsync(true)
+	for i := 0; i < 10; i++ {
+		c.Check(client.Counter("test.counter", 1), IsNil)
+	}
+	c.Check(client.DrainAndClose(time.Second), IsNil)
+	c.Check(transport.Messages(), HasLen, 10)
+	c.Check(client.Async(), Equals, false)
+	c.Check(client.Counter("test.counter", 1), Equals, hastur.ErrClosed)
+	FinishCapture()
+}
+
+// A transport whose sends wait until release is closed.
+type blockingTransport struct {
+	release chan struct{}
+	hastur.MemoryTransport
+}
+
+func (t *blockingTransport) Send(message []byte) error {
+	<-t.release
+	return t.MemoryTransport.Send(message)
+}
+
+func (s *HasturSuite) TestDrainAndCloseTimeout(c *C) {
+	transport := &blockingTransport{release: make(chan struct{})}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	client.SetAsync(true)
+	for i := 0; i < 3; i++ {
+		c.Check(client.Counter("test.counter", 1), IsNil)
+	}
+	err = client.DrainAndClose(10 * time.Millisecond)
+	c.Check(errors.Is(err, hastur.ErrDrainTimeout), Equals, true)
+	c.Check(client.Counter("test.counter", 1), Equals, hastur.ErrClosed)
+
+	// The remaining messages are still written once the transport unblocks, and then the client closes.
+	close(transport.release)
+	for client.Async() {
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(transport.Messages(), HasLen, 3)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestCounterAbsolute(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	for _, total := range []int64{100, 105, 105, 120, 7, 10} {
+		c.Check(client.CounterAbsolute("test.requests", total), IsNil)
+	}
+	c.Check(client.CounterAbsolute("test.other", 50), IsNil)
+
+	var values []interface{}
+	for _, message := range recorder.Messages() {
+		c.Check(message["name"], Equals, "test.requests")
+		values = append(values, message["value"])
+	}
+	c.Check(values, DeepEquals, []interface{}{float64(5), float64(0), float64(15), float64(7), float64(3)})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTimestampResolution(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	at := time.Unix(1700000000, 123456789)
+	c.Check(client.TimestampResolution(), Equals, hastur.Microsecond)
+	c.Check(client.Mark("test.mark", "", hastur.WithTimestamp(at)), IsNil)
+	client.SetTimestampResolution(hastur.Nanosecond)
+	c.Check(client.TimestampResolution(), Equals, hastur.Nanosecond)
+	c.Check(client.Mark("test.mark", "", hastur.WithTimestamp(at)), IsNil)
+
+	// Nanosecond timestamps don't fit exactly in a float64, so decode them as numbers.
+	var timestamps []string
+	for _, raw := range recorder.Raw() {
+		var message struct{ Timestamp json.Number }
+		c.Assert(json.Unmarshal(raw, &message), IsNil)
+		timestamps = append(timestamps, message.Timestamp.String())
+	}
+	c.Check(timestamps, DeepEquals, []string{"1700000000123456", "1700000000123456789"})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestHistogram(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	buckets := map[float64]uint64{0.5: 3, 2: 1, math.Inf(1): 4}
+	c.Check(client.Histogram("test.histogram", buckets, hastur.WithLabels(map[string]interface{}{"region": "eu"})), IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["type"], Equals, "histogram")
+	c.Check(messages[0]["name"], Equals, "test.histogram")
+	c.Check(messages[0]["buckets"], DeepEquals, map[string]interface{}{"0.5": float64(3), "2": float64(1),
+		"+Inf": float64(4)})
+	c.Check(messages[0]["labels"].(map[string]interface{})["region"], Equals, "eu")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestHistogramRecorderKeepsUnsent(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	histogram := hastur.NewHistogramRecorder([]float64{1})
+	histogram.Observe(0.5)
+	client.SetMetricFilter(func(name, messageType string) bool { return false })
+	c.Check(client.SendHistogram("test.latency", histogram), Equals, hastur.ErrFiltered)
+	c.Check(histogram.Buckets(), DeepEquals, map[float64]uint64{1: 1, math.Inf(1): 0})
+
+	histogram.Observe(2)
+	client.SetMetricFilter(nil)
+	c.Check(client.SendHistogram("test.latency", histogram), IsNil)
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["buckets"], DeepEquals, map[string]interface{}{"1": float64(1), "+Inf": float64(1)})
+	c.Check(histogram.Buckets(), DeepEquals, map[float64]uint64{1: 0, math.Inf(1): 0})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestHistogramRecorder(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	histogram := hastur.NewHistogramRecorder([]float64{1, 0.1, 1, math.NaN()})
+	c.Check(client.SendHistogram("test.latency", histogram), IsNil)
+	c.Check(recorder.Messages(), HasLen, 0)
+
+	for _, value := range []float64{0.05, 0.1, 0.5, 1, 3, math.NaN()} {
+		histogram.Observe(value)
+	}
+	c.Check(histogram.Buckets(), DeepEquals, map[float64]uint64{0.1: 2, 1: 2, math.Inf(1): 1})
+	c.Check(client.SendHistogram("test.latency", histogram), IsNil)
+	// Sending resets the counts.
+	c.Check(client.SendHistogram("test.latency", histogram), IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["buckets"], DeepEquals, map[string]interface{}{"0.1": float64(2), "1": float64(2),
+		"+Inf": float64(1)})
+	c.Check(histogram.Buckets(), DeepEquals, map[float64]uint64{0.1: 0, 1: 0, math.Inf(1): 0})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTruncationLimits(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	client.SetMaxEventSubjectLen(4)
+	client.SetMaxEventBodyLen(7)
+	client.SetMaxLogSubjectLen(10000)
+	// "é" and "ü" are two bytes each, so a four byte limit lands in the middle of "ü".
+	c.Check(client.Event("test.event", "héüo", "日本語です", []string{}), IsNil)
+	c.Check(client.Log(strings.Repeat("x", 8000), nil), IsNil)
+	client.Close()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 2)
+	var event, logMessage map[string]interface{}
+	c.Assert(json.Unmarshal(sent[0], &event), IsNil)
+	c.Check(event["subject"], Equals, "hé")
+	c.Check(event["body"], Equals, "日本")
+	c.Assert(json.Unmarshal(sent[1], &logMessage), IsNil)
+	c.Check(logMessage["subject"], HasLen, 8000)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTruncationNegativeLimits(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetMaxEventSubjectLen(-1)
+	client.SetMaxEventBodyLen(0)
+	client.SetMaxLogSubjectLen(-5)
+	c.Check(client.Event("test.event", "subject", "body", []string{}), IsNil)
+	c.Check(client.Log("subject", nil), IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["subject"], Equals, "")
+	c.Check(messages[0]["body"], Equals, "")
+	c.Check(messages[1]["subject"], Equals, "")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTruncationKeepsRunes(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	// Each multibyte rune straddles the default limit.
+	subject := strings.Repeat("a", hastur.DefaultMaxEventSubjectLen-1) + "😀"
+	body := strings.Repeat("b", hastur.DefaultMaxEventBodyLen-2) + "日本"
+	logSubject := strings.Repeat("c", hastur.DefaultMaxLogSubjectLen-1) + "語"
+	c.Check(client.Event("test.event", subject, body, []string{}), IsNil)
+	c.Check(client.Log(logSubject, nil), IsNil)
+	client.Close()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 2)
+	var event, logMessage map[string]interface{}
+	c.Assert(json.Unmarshal(sent[0], &event), IsNil)
+	c.Check(event["subject"], Equals, subject[:hastur.DefaultMaxEventSubjectLen-1])
+	c.Check(event["body"], Equals, body[:hastur.DefaultMaxEventBodyLen-2])
+	c.Assert(json.Unmarshal(sent[1], &logMessage), IsNil)
+	c.Check(logMessage["subject"], Equals, logSubject[:hastur.DefaultMaxLogSubjectLen-1])
+	FinishCapture()
+}
+
+type testContextKey string
+
+func (s *HasturSuite) TestContextLabels(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.RegisterContextLabel(testContextKey("trace"), "trace_id")
+	client.RegisterContextLabel(testContextKey("request"), "request_id")
+	ctx := context.WithValue(context.Background(), testContextKey("trace"), "abc123")
+	c.Check(client.CounterCtx(ctx, "test.counter", 1), IsNil)
+	c.Check(client.MarkCtx(ctx, "test.mark", "", hastur.WithLabels(map[string]interface{}{"trace_id": "mine"})), IsNil)
+	c.Check(client.GaugeCtx(context.Background(), "test.gauge", 1), IsNil)
+	client.Close()
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	c.Check(GetLabels(c, messages[0])["trace_id"], Equals, "abc123")
+	_, ok := GetLabels(c, messages[0])["request_id"]
+	c.Check(ok, Equals, false)
+	c.Check(GetLabels(c, messages[1])["trace_id"], Equals, "mine")
+	_, ok = GetLabels(c, messages[2])["trace_id"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *HasturSuite) TestDryRun(c *C) {
+	var output bytes.Buffer
+	hastur.SetDryRun(&output)
+	hastur.Mark("test.mark", "dry")
+	hastur.Counter("test.counter", 1)
+	hastur.SetDryRun(nil)
+	hastur.Mark("test.mark", "wet")
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	c.Assert(lines, HasLen, 2)
+	var message map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(lines[0]), &message), IsNil)
+	c.Check(message["value"], Equals, "dry")
+	c.Check(lines[1], Matches, `\{.*"type":"counter".*\}`)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "wet")
+}
+
+func (s *HasturSuite) TestConfigFromEnv(c *C) {
+	defer os.Unsetenv("HASTUR_UDP_ADDRESS")
+	defer os.Unsetenv("HASTUR_UDP_PORT")
+	defer os.Unsetenv("HASTUR_LABELS")
+	address, port, labels := hastur.ConfigFromEnv()
+	c.Check(address, Equals, "127.0.0.1")
+	c.Check(port, Equals, 8125)
+	c.Check(labels, HasLen, 0)
+
+	os.Setenv("HASTUR_UDP_ADDRESS", "agent.example.com")
+	os.Setenv("HASTUR_UDP_PORT", "9000")
+	os.Setenv("HASTUR_LABELS", "region=us, tier=web,bogus,")
+	address, port, labels = hastur.ConfigFromEnv()
+	c.Check(address, Equals, "agent.example.com")
+	c.Check(port, Equals, 9000)
+	c.Check(labels, DeepEquals, map[string]interface{}{"region": "us", "tier": "web"})
+
+	os.Setenv("HASTUR_UDP_PORT", "not a port")
+	_, port, _ = hastur.ConfigFromEnv()
+	c.Check(port, Equals, 8125)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestBatch(c *C) {
+	hastur.GaugeBatch(map[string]float64{"queue.b": 2, "queue.a": 1},
+		hastur.WithLabels(map[string]interface{}{"partition": "all"}))
+	hastur.CounterBatch(map[string]int{"requests": 5})
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	c.Check(messages[0]["name"], Equals, "queue.a")
+	c.Check(messages[1]["name"], Equals, "queue.b")
+	c.Check(messages[1]["value"], Equals, float64(2))
+	c.Check(messages[0]["timestamp"], Equals, messages[1]["timestamp"])
+	c.Check(GetLabels(c, messages[1])["partition"], Equals, "all")
+	c.Check(messages[2]["type"], Equals, "counter")
+}
+
+func (s *HasturSuite) TestBatchAsync(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetAsync(true)
+	c.Check(client.GaugeBatch(map[string]float64{"queue.a": 1, "queue.b": 2, "queue.c": 3}), IsNil)
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 3)
+	c.Check(messages[2]["name"], Equals, "queue.c")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestRuntimeMetrics(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	c.Check(hastur.ReportRuntimeMetrics(client), IsNil)
+	client.Close()
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 4)
+	values := make(map[string]float64)
+	for _, m := range messages {
+		c.Check(m["type"], Equals, "gauge")
+		values[m["name"].(string)] = m["value"].(float64)
+	}
+	c.Check(values["go.heap_alloc"] > 0, Equals, true)
+	c.Check(values["go.num_goroutine"] > 0, Equals, true)
+	c.Check(values["go.num_gc"] > 0, Equals, true)
+	c.Check(values["go.gc_pause"] >= 0, Equals, true)
+}
+
+func (s *HasturSuite) TestUptimeMetric(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	clock := hastur.NewFakeClock(time.Now())
+	defer hastur.SetClock(client, clock)()
+	c.Check(hastur.ReportUptime(client), IsNil)
+	clock.Advance(time.Minute)
+	c.Check(hastur.ReportUptime(client), IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "gauge")
+	c.Check(messages[0]["name"], Equals, "process.uptime_seconds")
+	first, second := messages[0]["value"].(float64), messages[1]["value"].(float64)
+	c.Check(first > 0, Equals, true)
+	c.Check(math.Abs(second-first-60) < 1e-6, Equals, true)
+	client.StartUptimeMetric(hastur.Minute).Stop()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestStableEncoding(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	at := time.Unix(1700000000, 0)
+	labels := make(map[string]interface{})
+	nested := make(map[string]interface{})
+	for i := 0; i < 50; i++ {
+		labels[fmt.Sprintf("label%d", i)] = i
+		nested[fmt.Sprintf("key%d", i)] = i
+	}
+	labels["nested"] = nested
+	for i := 0; i < 10; i++ {
+		c.Check(client.Gauge("test.gauge", 1, hastur.WithTimestamp(at), hastur.WithLabels(labels),
+			hastur.WithTags(map[string]interface{}{"b": 2, "a": 1})), IsNil)
+	}
+
+	raw := recorder.Raw()
+	c.Assert(raw, HasLen, 10)
+	for _, message := range raw[1:] {
+		c.Check(string(message), Equals, string(raw[0]))
+	}
+	c.Check(strings.Index(string(raw[0]), `"label1"`) < strings.Index(string(raw[0]), `"label2"`), Equals, true)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestGaugeMonotonicWarn(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	var warnings []error
+	var types []string
+	client.SetErrorHandler(func(err error, messageType string) {
+		warnings = append(warnings, err)
+		types = append(types, messageType)
+	})
+	for i := 0; i < 2*hastur.MonotonicGaugeSamples; i++ {
+		c.Check(client.Gauge("test.total", float64(i)), IsNil)
+	}
+	c.Check(warnings, HasLen, 0)
+
+	client.SetGaugeMonotonicWarn(true)
+	for i := 0; i < 2*hastur.MonotonicGaugeSamples; i++ {
+		c.Check(client.Gauge("test.total", float64(i)), IsNil)
+		c.Check(client.GaugeInt("test.queue", i%5), IsNil)
+	}
+	c.Check(recorder.Messages(), HasLen, 6*hastur.MonotonicGaugeSamples)
+	c.Assert(warnings, HasLen, 1)
+	var warning *hastur.MonotonicGaugeWarning
+	c.Assert(errors.As(warnings[0], &warning), Equals, true)
+	c.Check(warning.Name, Equals, "test.total")
+	c.Check(types, DeepEquals, []string{"gauge"})
+	c.Check(client.Snapshot().LastError, IsNil)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestGaugeMonotonicWarnSkipsOwnMetrics(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	clock := hastur.NewFakeClock(time.Now())
+	defer hastur.SetClock(client, clock)()
+	var warnings []error
+	client.SetErrorHandler(func(err error, messageType string) { warnings = append(warnings, err) })
+	client.SetGaugeMonotonicWarn(true)
+	for i := 0; i < 2*hastur.MonotonicGaugeSamples; i++ {
+		clock.Advance(time.Second)
+		c.Check(hastur.ReportSelfMetrics(client), IsNil)
+		c.Check(hastur.ReportUptime(client), IsNil)
+	}
+	c.Check(warnings, HasLen, 0)
+	c.Check(recorder.Messages(), HasLen, 2*hastur.MonotonicGaugeSamples*7)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestGaugeMonotonicWarnSampled(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	var warnings []error
+	client.SetErrorHandler(func(err error, messageType string) { warnings = append(warnings, err) })
+	client.SetGaugeMonotonicWarn(true)
+	for i := 0; i < 2*hastur.MonotonicGaugeSamples; i++ {
+		c.Check(client.GaugeSampled("test.total", float64(i), 0.999999), IsNil)
+	}
+	c.Assert(warnings, HasLen, 1)
+	var warning *hastur.MonotonicGaugeWarning
+	c.Assert(errors.As(warnings[0], &warning), Equals, true)
+	c.Check(warning.Name, Equals, "test.total")
+	c.Check(recorder.Messages()[0]["sample_rate"], Equals, 0.999999)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestWireFormat(c *C) {
+	var output bytes.Buffer
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetDryRun(&output)
+	client.CounterFull("test.counter", 3, time.Unix(1, 500000000), map[string]interface{}{"a": "b"})
+	client.Close()
+
+	// Keys appear in alphabetical order, as they did when messages were marshalled from maps.
+	c.Check(output.String(), Matches,
+		`\{"labels":\{"a":"b","app":"[^"]*"(,"host":"[^"]*")?,"pid":\d+\},"name":"test.counter","timestamp":1500000,"type":"counter","value":3\}\n`)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestStrictLabels(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetAppName("test.app")
+	client.SetStrictLabels(false)
+	err = client.MarkFull("test.mark", "foo", time.Now(),
+		map[string]interface{}{"good": 1, "bad": make(chan bool), "worse": func() {}})
+	c.Check(err, IsNil)
+	client.Close()
+	m := GetAndVerifySingleMessage(c)
+
+	c.Check(m["type"], Equals, "mark")
+	labels := GetLabels(c, m)
+	c.Check(labels["good"], Equals, float64(1))
+	c.Check(labels["label_error"], Equals, "bad,worse")
+	_, ok := labels["bad"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *HasturSuite) TestUnencodableLabels(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetStrictLabels(false)
+	type nested struct {
+		Callback func()
+		hidden   chan bool
+	}
+	err := client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{
+		"complex":  complex(1, 2),
+		"map":      map[string]interface{}{"inner": []interface{}{1, make(chan int)}},
+		"struct":   nested{},
+		"pointer":  &nested{},
+		"time":     time.Unix(0, 0).UTC(),
+		"unexport": struct{ hidden chan bool }{},
+		"nil":      (*nested)(nil),
+	})
+	c.Check(err, IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 1)
+	labels := messages[0]["labels"].(map[string]interface{})
+	c.Check(labels["complex"], Equals, "(1+2i)")
+	c.Check(labels["label_error"], Equals, "map,pointer,struct")
+	c.Check(labels["time"], Equals, "1970-01-01T00:00:00Z")
+	c.Check(labels["unexport"], DeepEquals, map[string]interface{}{})
+	c.Check(labels["nil"], IsNil)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestStrictLabelsKeepsDefaults(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetStrictLabels(false)
+	client.SetDefaultLabel("bad", make(chan bool))
+	client.Increment("test.counter")
+	client.Increment("test.counter")
+	_, ok := client.GetDefaultLabel("bad")
+	c.Check(ok, Equals, true)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 2)
+	for _, message := range messages {
+		c.Check(message["labels"].(map[string]interface{})["label_error"], Equals, "bad")
+	}
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEventAck(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Acknowledge only the events whose subject asks for it.
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			message := make(Message)
+			if json.Unmarshal(scanner.Bytes(), &message) == nil && message["subject"] == "ack me" {
+				fmt.Fprintf(conn, "{\"type\":\"ack\",\"id\":%q}\n", message["id"])
+			}
+		}
+	}()
+
+	client, err := hastur.NewClientWithNetwork("tcp", "127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	c.Assert(err, IsNil)
+	c.Check(client.EventAck("test.event", "ack me", "", nil, time.Second), IsNil)
+	c.Check(client.EventAck("test.event", "ignore me", "", nil, 50*time.Millisecond), Equals, hastur.ErrAckTimeout)
+	c.Check(client.EventAck("test.event", "ack me", "", nil, time.Second), IsNil)
+	client.Close()
+
+	udp, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	c.Check(udp.EventAck("test.event", "ack me", "", nil, time.Second), Equals, hastur.ErrAckUnsupported)
+	udp.Close()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestSnapshot(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	c.Check(client.Snapshot().LastError, IsNil)
+	client.Mark("test.mark", "foo")
+	client.Counter("test.counter", 1)
+	client.Close()
+	client.Gauge("test.gauge", 1)
+
+	stats := client.Snapshot()
+	c.Check(stats.Sent, Equals, uint64(2))
+	c.Check(stats.BytesWritten, Equals, uint64(len(transport.Messages()[0])+len(transport.Messages()[1])))
+	c.Check(stats.Dropped, DeepEquals, map[hastur.DropReason]uint64{hastur.DropClosed: 1})
+	c.Check(stats.QueueDepth, Equals, 0)
+	c.Check(stats.LastError, Equals, hastur.ErrClosed)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestFlattenLabels(c *C) {
+	labels := map[string]interface{}{
+		"a":     map[string]interface{}{"b": 1, "c": map[string]interface{}{"d": "e"}},
+		"env":   map[string]string{"name": "prod"},
+		"plain": "value",
+		"req":   hastur.NewLabels().Set("id", "abc").Set("route", hastur.NewLabels().Set("name", "home")),
+	}
+	hastur.MarkFull("test.mark", "", time.Now(), labels)
+	hastur.SetFlattenLabels(true)
+	hastur.MarkFull("test.mark", "", time.Now(), labels)
+	hastur.SetLabelSeparator("/")
+	hastur.MarkFull("test.mark", "", time.Now(), labels)
+	hastur.SetLabelSeparator(".")
+	hastur.SetFlattenLabels(false)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	c.Check(GetLabels(c, messages[0])["a"], DeepEquals, map[string]interface{}{"b": float64(1),
+		"c": map[string]interface{}{"d": "e"}})
+	flat := GetLabels(c, messages[1])
+	c.Check(flat["a.b"], Equals, float64(1))
+	c.Check(flat["a.c.d"], Equals, "e")
+	c.Check(flat["env.name"], Equals, "prod")
+	c.Check(flat["plain"], Equals, "value")
+	c.Check(flat["req.id"], Equals, "abc")
+	c.Check(flat["req.route.name"], Equals, "home")
+	VerifyCommonAttributes(c, messages[1])
+	c.Check(GetLabels(c, messages[2])["a/c/d"], Equals, "e")
+}
+
+func (s *HasturSuite) TestPing(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	c.Check(client.Ping(), IsNil)
+
+	health, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	healthPort := health.Addr().(*net.TCPAddr).Port
+	client.SetHealthPort(healthPort)
+	c.Check(client.Ping(), IsNil)
+	health.Close()
+	c.Check(client.Ping(), NotNil)
+
+	client.Close()
+	c.Check(client.Ping(), Equals, hastur.ErrClosed)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestCounterInt64(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	c.Check(client.CounterInt64("test.bytes", 5000000000), IsNil)
+	client.Close()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 1)
+	c.Check(string(sent[0]), Matches, `.*"type":"counter","value":5000000000\}`)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestCounterFloat(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetTransport(transport)
+	c.Check(client.CounterFloat("test.work_seconds", 12345.678901234), IsNil)
+	c.Check(client.CounterFloat("test.work_seconds", 1e-9), IsNil)
+	client.Close()
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 2)
+	c.Check(string(sent[0]), Matches, `.*"type":"counter","value":12345.678901234\}`)
+	var message struct{ Value float64 }
+	c.Assert(json.Unmarshal(sent[1], &message), IsNil)
+	c.Check(message.Value, Equals, 1e-9)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestScopedLabels(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	labels := map[string]interface{}{"request": "a"}
+	client.WithScopedLabels(labels, func(scope *hastur.Scope) {
+		labels["request"] = "changed"
+		c.Check(scope.Counter("test.counter", 1), IsNil)
+		scope.WithScopedLabels(map[string]interface{}{"step": "parse"}, func(inner *hastur.Scope) {
+			own := hastur.WithLabels(map[string]interface{}{"request": "own"})
+			c.Check(inner.Mark("test.mark", "", own), IsNil)
+		})
+	})
+	c.Check(client.Counter("test.counter", 1), IsNil)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 3)
+	first := messages[0]["labels"].(map[string]interface{})
+	c.Check(first["request"], Equals, "a")
+	c.Check(first["app"], Not(IsNil))
+	second := messages[1]["labels"].(map[string]interface{})
+	c.Check(second["request"], Equals, "own")
+	c.Check(second["step"], Equals, "parse")
+	_, ok := messages[2]["labels"].(map[string]interface{})["request"]
+	c.Check(ok, Equals, false)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestScopedLabelsConcurrent(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	done := make(chan bool)
+	for _, request := range []string{"a", "b"} {
+		go func(request string) {
+			client.WithScopedLabels(map[string]interface{}{"request": request}, func(scope *hastur.Scope) {
+				for i := 0; i < 50; i++ {
+					scope.Counter("test."+request, 1)
+				}
+			})
+			done <- true
+		}(request)
+	}
+	for i := 0; i < 50; i++ {
+		client.Counter("test.none", 1)
+	}
+	<-done
+	<-done
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 150)
+	for _, message := range messages {
+		request, _ := message["labels"].(map[string]interface{})["request"].(string)
+		if message["name"] == "test.none" {
+			c.Check(request, Equals, "")
+		} else {
+			c.Check(message["name"], Equals, "test."+request)
+		}
+	}
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestRateLimit(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	clock := hastur.NewFakeClock(time.Now())
+	defer hastur.SetClock(client, clock)()
+	client.SetRateLimit("test.hot", 2)
+	c.Check(client.Increment("test.hot"), IsNil)
+	c.Check(client.Increment("test.hot"), IsNil)
+	c.Check(client.Increment("test.hot"), Equals, hastur.ErrRateLimited)
+	c.Check(client.Increment("test.cold"), IsNil)
+	clock.Advance(500 * time.Millisecond)
+	c.Check(client.Increment("test.hot"), IsNil)
+	c.Check(client.Increment("test.hot"), Equals, hastur.ErrRateLimited)
+	client.SetRateLimit("test.hot", 0)
+	c.Check(client.Increment("test.hot"), IsNil)
+
+	client.SetGlobalRateLimit(1)
+	c.Check(client.Mark("test.mark", ""), IsNil)
+	c.Check(client.Log("limited", nil), Equals, hastur.ErrRateLimited)
+	c.Check(client.DroppedMessagesByReason()[hastur.DropRateLimited], Equals, uint64(3))
+	c.Check(hastur.DropRateLimited.String(), Equals, "rate_limited")
+	client.Close()
+
+	messages := FinishCapture()
+	c.Check(messages, HasLen, 6)
+}
+
+func (s *HasturSuite) TestRateLimitsChargeTogether(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	clock := hastur.NewFakeClock(time.Now())
+	defer hastur.SetClock(client, clock)()
+	client.SetRateLimit("test.hot", 1)
+	client.SetGlobalRateLimit(1)
+	c.Check(client.Log("first", nil), IsNil)
+	// The global limit rejects the message, so the per-name token is kept.
+	c.Check(client.Increment("test.hot"), Equals, hastur.ErrRateLimited)
+	clock.Advance(time.Second)
+	c.Check(client.Increment("test.hot"), IsNil)
+
+	// And a message rejected by its own limit doesn't use up a global token.
+	client.SetGlobalRateLimit(2)
+	c.Check(client.Increment("test.hot"), Equals, hastur.ErrRateLimited)
+	c.Check(client.Log("second", nil), IsNil)
+	c.Check(client.Log("third", nil), IsNil)
+	c.Check(client.Log("fourth", nil), Equals, hastur.ErrRateLimited)
+	c.Check(recorder.Messages(), HasLen, 4)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestAggregatedCounter(c *C) {
+	counter := hastur.AggregatedCounter("test.hot")
+	for i := 0; i < 100; i++ {
+		counter.Add(2)
+	}
+	c.Check(counter.Flush(), IsNil)
+	c.Check(counter.Flush(), IsNil)
+	counter.Add(-1)
+	c.Check(counter.Stop(), IsNil)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "counter")
+	c.Check(messages[0]["value"], Equals, float64(200))
+	c.Check(messages[1]["value"], Equals, float64(-1))
+}
+
+func (s *HasturSuite) TestOutput(c *C) {
+	var output bytes.Buffer
+	hastur.SetOutput(&output)
+	hastur.Mark("test.mark", "copied")
+	hastur.SetOutput(nil)
+	hastur.Mark("test.mark", "not copied")
+
+	c.Check(output.String(), Matches, `\{.*"value":"copied"\}\n`)
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["value"], Equals, "copied")
+}
+
+func (s *HasturSuite) TestGaugeFuncAndCounterFunc(c *C) {
+	client, recorder := hasturtest.NewClient()
+	total := int64(100)
+	reads := make(chan bool, 100)
+	counter := hastur.CounterFuncEvery(client, "test.counter", 10*time.Millisecond, func() int64 {
+		total += 5
+		reads <- true
+		return total
+	})
+	<-reads
+	<-reads
+	<-reads
+	counter.Stop()
+	gauge := hastur.GaugeFuncEvery(client, "test.gauge", 10*time.Millisecond, func() float64 { return 2.5 })
+	for len(recorder.Messages()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	gauge.Stop()
+	client.Close()
+
+	sent := recorder.Messages()
+	c.Check(sent[0]["name"], Equals, "test.counter")
+	c.Check(sent[0]["value"], Equals, float64(5))
+	c.Check(sent[len(sent)-1]["name"], Equals, "test.gauge")
+	c.Check(sent[len(sent)-1]["value"], Equals, 2.5)
+	c.Check(func() { hastur.GaugeFunc("test.gauge", hastur.Interval(-1), nil) }, Panics,
+		"GaugeFunc called with bad interval.")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestSetEnabled(c *C) {
+	runs := make(chan bool, 10)
+	hastur.SetEnabled(false)
+	c.Check(hastur.Enabled(), Equals, false)
+	stopper := hastur.EveryDuration(time.Millisecond, func() { runs <- true })
+	hastur.Mark("test.mark", "disabled")
+	hastur.Counter("test.counter", 1)
+	time.Sleep(20 * time.Millisecond)
+	c.Check(runs, HasLen, 0)
+	hastur.SetEnabled(true)
+	<-runs
+	stopper.Stop()
+	hastur.Mark("test.mark", "enabled")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "enabled")
+}
+
+func (s *HasturSuite) TestDisabledCountsNothing(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetRateLimit("test.limited", 1)
+	client.SetMetricFilter(hastur.DenyPrefixes("test.denied"))
+	client.SetEnabled(false)
+	for i := 0; i < 3; i++ {
+		c.Check(client.Counter("test.limited", 1), IsNil)
+		c.Check(client.Counter("test.denied", 1), IsNil)
+		c.Check(client.GaugeSampled("test.denied", 1, 0.5), IsNil)
+		c.Check(client.Histogram("test.denied", map[float64]uint64{1: 1}), IsNil)
+		c.Check(client.Event("test.denied", "subject", "body", nil), IsNil)
+	}
+	c.Check(client.DroppedMessages(), Equals, uint64(0))
+	c.Check(recorder.Messages(), HasLen, 0)
+
+	// The rate limit's token is still there once the client is enabled again.
+	client.SetEnabled(true)
+	c.Check(client.Counter("test.limited", 1), IsNil)
+	c.Check(recorder.Messages(), HasLen, 1)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestLogLevel(c *C) {
+	data := map[string]interface{}{"user": "bob"}
+	hastur.LogLevel(hastur.Warn, "disk nearly full", data)
+	hastur.LogLevel(hastur.Error, "request failed", "timeout",
+		hastur.WithLabels(map[string]interface{}{"region": "us"}))
+	c.Check(data, HasLen, 1)
+	c.Check(hastur.Severity(99).String(), Equals, "unknown")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(messages[0]["type"], Equals, "log")
+	c.Check(messages[0]["data"], DeepEquals, map[string]interface{}{"user": "bob", "severity": "warn"})
+	c.Check(messages[0]["labels"].(map[string]interface{})["severity"], Equals, "warn")
+	c.Check(messages[1]["data"], DeepEquals, map[string]interface{}{"data": "timeout", "severity": "error"})
+	labels := messages[1]["labels"].(map[string]interface{})
+	c.Check(labels["severity"], Equals, "error")
+	c.Check(labels["region"], Equals, "us")
+}
+
+func (s *HasturSuite) TestLogWriter(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetAppName("test.app")
+	writer := client.NewLogWriter(map[string]interface{}{"source": "stdlib"})
+	logger := log.New(writer, "", 0)
+	client.SetErrorHandler(func(err error, messageType string) {
+		logger.Printf("hastur error: %s", err)
+	})
+	logger.Println("first line")
+	writer.Write([]byte("second "))
+	writer.Write([]byte("line\n\nthird line\r\npartial"))
+	client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+	client.Close()
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	for i, subject := range []string{"first line", "second line", "third line"} {
+		c.Check(messages[i]["type"], Equals, "log")
+		c.Check(messages[i]["subject"], Equals, subject)
+		c.Check(messages[i]["labels"].(map[string]interface{})["source"], Equals, "stdlib")
+	}
+}
+
+func (s *HasturSuite) TestLogWriterDuringErrorHandler(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	logger := log.New(client.NewLogWriter(nil), "", 0)
+	entered := make(chan bool)
+	release := make(chan bool)
+	client.SetErrorHandler(func(err error, messageType string) {
+		entered <- true
+		<-release
+		logger.Printf("hastur error: %s", err)
+	})
+	done := make(chan bool)
+	go func() {
+		client.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"foo": make(chan bool)})
+		done <- true
+	}()
+	<-entered
+	logger.Println("unrelated line")
+	close(release)
+	<-done
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["subject"], Equals, "unrelated line")
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestSlogHandler(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	client.SetAppName("test.app")
+	handler := client.NewSlogHandler(&slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := slog.New(handler).With("service", "api").WithGroup("request")
+	logger.Debug("handled", "status", 200, slog.Group("timing", "elapsed", time.Second))
+	slog.New(handler).Warn("slow", "err", errors.New("timeout"), slog.Group("empty"))
+	logger.WithGroup("unused").Error("failed")
+	c.Check(client.NewSlogHandler(nil).Enabled(context.Background(), slog.LevelDebug), Equals, false)
+	client.Close()
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	c.Check(messages[0]["subject"], Equals, "handled")
+	c.Check(messages[0]["data"], DeepEquals, map[string]interface{}{
+		"service":  "api",
+		"request":  map[string]interface{}{"status": float64(200), "timing": map[string]interface{}{"elapsed": "1s"}},
+		"severity": "debug",
+	})
+	c.Check(messages[1]["data"], DeepEquals, map[string]interface{}{"err": "timeout", "severity": "warn"})
+	c.Check(messages[1]["labels"].(map[string]interface{})["severity"], Equals, "warn")
+	c.Check(messages[2]["data"], DeepEquals, map[string]interface{}{"service": "api", "severity": "error"})
+}
+
+func (s *HasturSuite) TestTags(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.Counter("test.counter", 1)
+	client.AddDefaultTags(map[string]interface{}{"tier": "web"})
+	client.Counter("test.counter", 1, hastur.WithTags(map[string]interface{}{"region": "us", "tier": "db"}),
+		hastur.WithLabels(map[string]interface{}{"request": "abc123"}))
+	client.RemoveDefaultTags("tier")
+	client.Event("test.event", "subject", "body", nil, hastur.WithTags(map[string]interface{}{"region": "eu"}))
+	c.Check(client.DefaultTags(), HasLen, 0)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 3)
+	_, ok := messages[0]["tags"]
+	c.Check(ok, Equals, false)
+	c.Check(string(recorder.Raw()[0]), Not(Matches), `.*tags.*`)
+	c.Check(messages[1]["tags"], DeepEquals, map[string]interface{}{"region": "us", "tier": "db"})
+	labels := messages[1]["labels"].(map[string]interface{})
+	c.Check(labels["request"], Equals, "abc123")
+	c.Check(labels, HasLen, 4)
+	c.Check(messages[2]["tags"], DeepEquals, map[string]interface{}{"region": "eu"})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestTagsAreNotLabels(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.AddDefaultTags(map[string]interface{}{"tier": "web"})
+	client.LogLevel(hastur.Warn, "subject", nil, hastur.WithTags(map[string]interface{}{"region": "us"}))
+	client.GaugeBatch(map[string]float64{"test.gauge": 1}, hastur.WithTags(map[string]interface{}{"region": "eu"}))
+	client.CounterFull("test.counter", 1, time.Now(), map[string]interface{}{"\x00tags": "label"})
+	c.Check(client.DefaultTags(), DeepEquals, map[string]interface{}{"tier": "web"})
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 3)
+	c.Check(messages[0]["tags"], DeepEquals, map[string]interface{}{"region": "us", "tier": "web"})
+	c.Check(messages[0]["labels"].(map[string]interface{})["severity"], Equals, "warn")
+	c.Check(messages[1]["tags"], DeepEquals, map[string]interface{}{"region": "eu", "tier": "web"})
+	c.Check(messages[2]["tags"], DeepEquals, map[string]interface{}{"tier": "web"})
+	c.Check(messages[2]["labels"].(map[string]interface{})["\x00tags"], Equals, "label")
+	FinishCapture()
+}
+
+func BenchmarkCounter(b *testing.B) {
+	client, err := hastur.NewClient("127.0.0.1", 8125)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	client.AddDefaultLabels(map[string]interface{}{"region": "us", "tier": "web"})
+	client.SetDryRun(io.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.Counter("bench.counter", 1)
+	}
+}
+
+func BenchmarkCounterWithLabels(b *testing.B) {
+	client, err := hastur.NewClient("127.0.0.1", 8125)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	client.AddDefaultLabels(map[string]interface{}{"region": "us", "tier": "web"})
+	client.SetDryRun(io.Discard)
+	labels := map[string]interface{}{"endpoint": "/users", "status": 200}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.Counter("bench.counter", 1, hastur.WithLabels(labels))
+	}
+}
+
+func (s *HasturSuite) TestCompound(c *C) {
+	values := map[string]float64{"count": 3, "sum": 12.5, "min": 1, "max": 8}
+	hastur.Compound("test.batch", values, hastur.WithLabels(map[string]interface{}{"queue": "jobs"}))
+	values["count"] = 4
+
+	m := GetAndVerifySingleMessage(c)
+	c.Check(m["type"], Equals, "compound")
+	c.Check(m["name"], Equals, "test.batch")
+	c.Check(m["values"], DeepEquals, map[string]interface{}{"count": 3.0, "sum": 12.5, "min": 1.0, "max": 8.0})
+	c.Check(GetLabels(c, m)["queue"], Equals, "jobs")
+}
+
+func (s *HasturSuite) TestSelfMetrics(c *C) {
+	client, recorder := hasturtest.NewClient()
+	client.SetStrictNames(true)
+	client.Increment("test.counter")
+	client.Increment("not a valid name")
+	c.Check(hastur.ReportSelfMetrics(client), IsNil)
+	client.Close()
+
+	gauges := make(map[string]interface{})
+	for _, message := range recorder.Messages()[1:] {
+		c.Check(message["type"], Equals, "gauge")
+		gauges[message["name"].(string)] = message["value"]
+	}
+	c.Check(gauges, DeepEquals, map[string]interface{}{
+		"hastur.client.sent":          1.0,
+		"hastur.client.bytes_written": float64(len(recorder.Raw()[0])),
+		"hastur.client.dropped":       1.0,
+		"hastur.client.reconnects":    0.0,
+		"hastur.client.skipped_ticks": 0.0,
+		"hastur.client.queue_depth":   0.0,
+	})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestAtMethods(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	at := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	client.MarkAt("test.mark", "foo", at)
+	client.SetAt("test.set", "foo", at)
+	client.CounterAt("test.counter", 2, at)
+	client.GaugeAt("test.gauge", 1.5, at)
+	client.TimerAt("test.timer", 0.25, at)
+	client.CompoundAt("test.compound", map[string]float64{"count": 1}, at)
+	client.EventAt("test.event", "subject", "body", nil, at)
+	client.LogAt("subject", nil, at)
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 8)
+	types := make([]interface{}, len(messages))
+	for i, message := range messages {
+		types[i] = message["type"]
+		c.Check(message["timestamp"], Equals, float64(at.UnixNano()/1000))
+	}
+	c.Check(types, DeepEquals, []interface{}{"mark", "set", "counter", "gauge", "timer", "compound", "event", "log"})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestZeroTimestamp(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	now := time.Date(2013, 1, 2, 3, 4, 5, 6000, time.UTC)
+	defer hastur.SetClock(client, hastur.NewFakeClock(now))()
+	client.CounterFull("test.counter", 1, time.Time{}, nil)
+	client.EventFull("test.event", "subject", "body", nil, time.Time{}, nil)
+	client.GaugeAt("test.gauge", 1, time.Time{})
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 3)
+	for _, message := range messages {
+		c.Check(message["timestamp"], Equals, float64(now.UnixNano()/1000))
+	}
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestStatusMark(c *C) {
+	hastur.StatusMark("test.health", hastur.Green)
+	hastur.StatusMark("test.health", hastur.Yellow)
+	hastur.StatusMark("test.health", hastur.Red)
+	c.Check(hastur.Status(7).String(), Equals, "Unknown")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 3)
+	for i, value := range []string{"Green", "Yellow", "Red"} {
+		c.Check(messages[i]["type"], Equals, "mark")
+		c.Check(messages[i]["value"], Equals, value)
+	}
+}
+
+func (s *HasturSuite) TestSubscribe(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	first := client.Subscribe()
+	second := client.Subscribe()
+	client.Counter("test.counter", 2)
+	client.Unsubscribe(first)
+	client.Mark("test.mark", "foo")
+
+	for message := range first {
+		c.Check(message["name"], Equals, "test.counter")
+		c.Check(message["value"], Equals, 2.0)
+	}
+	c.Check((<-second)["type"], Equals, "counter")
+	c.Check((<-second)["type"], Equals, "mark")
+	c.Check(recorder.Messages(), HasLen, 2)
+	client.Unsubscribe(second)
+	client.Unsubscribe(second)
+
+	// A subscriber which falls behind doesn't hold up sending.
+	slow := client.Subscribe()
+	for i := 0; i < hastur.SubscriberBuffer+1; i++ {
+		client.Increment("test.counter")
+	}
+	c.Check(slow, HasLen, hastur.SubscriberBuffer)
+	c.Check(recorder.Messages(), HasLen, hastur.SubscriberBuffer+3)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEveryAtSchedules(c *C) {
+	now := time.Date(2024, 3, 9, 13, 45, 10, 0, time.UTC)
+	next := func(spec string, after time.Time) time.Time {
+		t, err := hastur.NextScheduled(spec, after)
+		c.Assert(err, IsNil)
+		return t
+	}
+	c.Check(next("daily 00:00 UTC", now), Equals, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+	c.Check(next("daily 14:00 UTC", now), Equals, time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC))
+	c.Check(next("hourly :30 UTC", now), Equals, time.Date(2024, 3, 9, 14, 30, 0, 0, time.UTC))
+	c.Check(next("hourly :50 UTC", now), Equals, time.Date(2024, 3, 9, 13, 50, 0, 0, time.UTC))
+	// A run exactly on the schedule is followed by the next one.
+	c.Check(next("hourly :00 UTC", time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC)), Equals,
+		time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC))
+
+	// Clocks in New York go forward on 2024-03-10, so that day is 23 hours long.
+	newYork, err := time.LoadLocation("America/New_York")
+	c.Assert(err, IsNil)
+	first := next("daily 00:00 America/New_York", now)
+	c.Check(first.Equal(time.Date(2024, 3, 10, 0, 0, 0, 0, newYork)), Equals, true)
+	second := next("daily 00:00 America/New_York", first)
+	c.Check(second.Sub(first), Equals, 23*time.Hour)
+	c.Check(second.In(newYork).Hour(), Equals, 0)
+
+	for _, spec := range []string{"", "daily", "daily 24:00", "daily 1:00", "daily :30", "hourly 01:30",
+		"hourly :60", "weekly 00:00", "daily 00:00 Nowhere/Special", "daily 00:00 UTC extra"} {
+		stopper, err := hastur.EveryAt(spec, func() {})
+		c.Check(errors.Is(err, hastur.ErrInvalidSchedule), Equals, true)
+		c.Check(stopper, IsNil)
+	}
+	stopper, err := hastur.EveryAt("hourly :00", func() {})
+	c.Check(err, IsNil)
+	stopper.Stop()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEverySkipsSlowTicks(c *C) {
+	skipped := hastur.Snapshot().SkippedTicks
+	runs := make(chan [2]time.Time, 10)
+	stopper := hastur.EveryDuration(10*time.Millisecond, func() {
+		start := time.Now()
+		time.Sleep(15 * time.Millisecond)
+		runs <- [2]time.Time{start, time.Now()}
+	})
+	previous := <-runs
+	for i := 0; i < 2; i++ {
+		run := <-runs
+		// Without skipping, the tick which came due during the previous run would start this one right away.
+		c.Check(run[0].Sub(previous[1]) >= time.Millisecond, Equals, true)
+		previous = run
+	}
+	stopper.Stop()
+	c.Check(hastur.Snapshot().SkippedTicks-skipped >= 3, Equals, true)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestEventRetry(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	received := make(chan string, 20)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Acknowledge an event the second time it arrives, and never acknowledge those which ask to be ignored.
+		seen := make(map[interface{}]bool)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			message := make(Message)
+			if json.Unmarshal(scanner.Bytes(), &message) != nil {
+				continue
+			}
+			received <- message["subject"].(string)
+			if seen[message["id"]] && message["subject"] != "ignore me" {
+				fmt.Fprintf(conn, "{\"type\":\"ack\",\"id\":%q}\n", message["id"])
+			}
+			seen[message["id"]] = true
+		}
+	}()
+
+	client, err := hastur.NewClientWithNetwork("tcp", "127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetEventRetry(3, 10*time.Millisecond)
+	c.Check(client.Event("test.event", "ack me", "", nil), IsNil)
+	c.Check(<-received, Equals, "ack me")
+	c.Check(<-received, Equals, "ack me")
+	c.Check(client.Event("test.event", "ignore me", "", nil), IsNil)
+	for i := 0; i < 3; i++ {
+		c.Check(<-received, Equals, "ignore me")
+	}
+	for client.Snapshot().EventGiveUps == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stats := client.Snapshot()
+	c.Check(stats.EventRetries, Equals, uint64(3))
+	c.Check(stats.EventGiveUps, Equals, uint64(1))
+	c.Check(received, HasLen, 0)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestDialTimeout(c *C) {
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetDialTimeout(50 * time.Millisecond)
+	// 192.0.2.0/24 is reserved for documentation, so nothing answers there: the dial either fails right away
+	// or times out.
+	start := time.Now()
+	client.SetNetwork("tcp")
+	c.Check(client.SetUdpAddress("192.0.2.1"), NotNil)
+	c.Check(time.Since(start) < time.Second, Equals, true)
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestLabelsBuilder(c *C) {
+	labels := hastur.NewLabels().Set("region", "us").Set("az", "a")
+	c.Check(labels.Merge(map[string]interface{}{"az": "b", "tier": "web"}), DeepEquals,
+		hastur.Labels{"region": "us", "az": "b", "tier": "web"})
+	hastur.CounterFull("test.counter", 1, time.Now(), labels)
+	hastur.Counter("test.counter", 1, hastur.WithLabels(hastur.NewLabels().Set("region", "eu")))
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	c.Check(GetLabels(c, messages[0])["tier"], Equals, "web")
+	c.Check(GetLabels(c, messages[1])["region"], Equals, "eu")
+}
+
+func (s *HasturSuite) TestMetricFilter(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetPrefix("svc")
+	client.SetMetricFilter(hastur.DenyPrefixes("noisy.", "debug."))
+	c.Check(client.Counter("noisy.counter", 1), Equals, hastur.ErrFiltered)
+	c.Check(client.Gauge("quiet.gauge", 1), IsNil)
+	client.SetMetricFilter(hastur.AllowPrefixes("quiet."))
+	c.Check(client.Mark("other.mark", "foo"), Equals, hastur.ErrFiltered)
+	c.Check(client.Mark("quiet.mark", "foo"), IsNil)
+	client.SetMetricFilter(func(name, messageType string) bool { return messageType != "event" })
+	c.Check(client.Event("quiet.event", "subject", "body", nil), Equals, hastur.ErrFiltered)
+	client.Log("logs are never filtered", nil)
+	client.SetMetricFilter(nil)
+	client.Increment("noisy.counter")
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 4)
+	c.Check(messages[0]["name"], Equals, "svc.quiet.gauge")
+	c.Check(messages[1]["name"], Equals, "svc.quiet.mark")
+	c.Check(messages[2]["type"], Equals, "log")
+	c.Check(messages[3]["name"], Equals, "svc.noisy.counter")
+	c.Check(client.DroppedMessagesByReason()[hastur.DropFiltered], Equals, uint64(3))
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestLabelMergeStrategy(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetAppName("test.app")
+	labels := map[string]interface{}{"app": "other.app", "region": "us"}
+	client.SetLabelMergeStrategy(hastur.DefaultsWin)
+	client.Mark("test.mark", "defaults win", hastur.WithLabels(labels))
+	client.SetLabelMergeStrategy(hastur.CallerWins)
+	client.Mark("test.mark", "caller wins", hastur.WithLabels(labels))
+	client.SetLabelMergeStrategy(hastur.CallerOnly)
+	client.Mark("test.mark", "caller only", hastur.WithLabels(labels))
+	client.Mark("test.mark", "no labels")
+
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 4)
+	c.Check(messages[0]["labels"].(map[string]interface{})["app"], Equals, "test.app")
+	c.Check(messages[1]["labels"].(map[string]interface{})["app"], Equals, "other.app")
+	c.Check(messages[1]["labels"].(map[string]interface{})["pid"], NotNil)
+	c.Check(messages[2]["labels"], DeepEquals, map[string]interface{}{"app": "other.app", "region": "us"})
+	c.Check(messages[3]["labels"], DeepEquals, map[string]interface{}{})
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestCallerLabelsOverrideDefaults(c *C) {
+	hastur.SetDefaultLabel("region", "us")
+	defer hastur.RemoveDefaultLabels("region")
+	hastur.MarkFull("test.mark", "foo", time.Now(), map[string]interface{}{"app": "caller.app", "region": "eu"})
+	hastur.Mark("test.mark", "foo")
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 2)
+	labels := GetLabels(c, messages[0])
+	c.Check(labels["app"], Equals, "caller.app")
+	c.Check(labels["region"], Equals, "eu")
+	c.Check(labels["pid"], Equals, float64(os.Getpid()))
+	labels = GetLabels(c, messages[1])
+	c.Check(labels["app"], Equals, hastur.AppName())
+	c.Check(labels["region"], Equals, "us")
+}
+
+func BenchmarkCounterCheckedLabels(b *testing.B) {
+	client, err := hastur.NewClient("127.0.0.1", 8125)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	client.SetStrictLabels(false)
+	client.SetDryRun(io.Discard)
+	labels := map[string]interface{}{
+		"endpoint": "/users",
+		"status":   200,
+		"tags":     []string{"a", "b"},
+		"bad":      make(chan bool),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.Counter("bench.counter", 1, hastur.WithLabels(labels))
+	}
+}
+
+func (s *HasturSuite) TestSetConn(c *C) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	client := hastur.NewClientWithConn(conn)
+	c.Check(client.Network(), Equals, "udp")
+	client.Mark("test.mark", "one")
+	client.Mark("test.mark", "two")
+	c.Check(<-lines, Matches, `\{.*"value":"one".*\}`)
+	c.Check(<-lines, Matches, `\{.*"value":"two".*\}`)
+	c.Check(client.Close(), IsNil)
+
+	// The client leaves the connection open for its owner.
+	go conn.Write([]byte("still open\n"))
+	c.Check(<-lines, Equals, "still open")
+	conn.Close()
+	FinishCapture()
+}
+
+func (s *HasturSuite) TestSetConnThenDial(c *C) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, server)
+
+	client, err := hastur.NewClient("127.0.0.1", testPort)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetAppName("test.app")
+	client.SetConn(conn)
+	c.Check(client.Mark("test.mark", "pipe"), IsNil)
+	// Leaving the external connection dials UDP again, not the pipe's network.
+	c.Check(client.SetUdpPort(testPort), IsNil)
+	c.Check(client.Network(), Equals, "udp")
+	c.Check(client.Mark("test.mark", "udp"), IsNil)
+
+	messages := FinishCapture()
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0]["value"], Equals, "udp")
+}
+
+// Create a self-signed certificate for 127.0.0.1.
+func selfSignedCert(c *C) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func (s *HasturSuite) TestTLS(c *C) {
+	cert, pool := selfSignedCert(c)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	client, err := hastur.NewClientWithNetwork("tcp", "127.0.0.1", port)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	c.Check(client.SetTLSConfig(&tls.Config{}), ErrorMatches, ".*certificate.*")
+	c.Check(client.SetTLSConfig(&tls.Config{RootCAs: pool}), IsNil)
+	c.Check(client.Mark("test.mark", "secret"), IsNil)
+	c.Check(<-lines, Matches, `\{.*"value":"secret".*\}`)
+	FinishCapture()
 }
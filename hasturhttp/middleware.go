@@ -0,0 +1,77 @@
+/*
+Package hasturhttp reports HTTP server metrics to Hastur.
+
+Wrap a handler with HandlerMiddleware to time every request and count responses:
+
+	http.ListenAndServe(":8080", hasturhttp.HandlerMiddleware(mux))
+
+For each request, a "http.request.duration" timer (in seconds) and a "http.responses" counter are sent, both
+labeled with the request "method" and the response "status" code.
+*/
+package hasturhttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.corp.ooyala.com/hastur-go"
+)
+
+// HandlerMiddleware wraps next, reporting each request's duration and response status with the default
+// Hastur client.
+func HandlerMiddleware(next http.Handler) http.Handler {
+	return ClientMiddleware(nil, next)
+}
+
+// ClientMiddleware is the same as HandlerMiddleware but reports with the given client. A nil client means the
+// default client.
+func ClientMiddleware(client *hastur.Client, next http.Handler) http.Handler {
+	timer := func(name string, value float64, timestamp time.Time, labels map[string]interface{}) {
+		hastur.TimerFull(name, value, timestamp, labels)
+	}
+	counter := func(name string, value int, timestamp time.Time, labels map[string]interface{}) {
+		hastur.CounterFull(name, value, timestamp, labels)
+	}
+	if client != nil {
+		timer = func(name string, value float64, timestamp time.Time, labels map[string]interface{}) {
+			client.TimerFull(name, value, timestamp, labels)
+		}
+		counter = func(name string, value int, timestamp time.Time, labels map[string]interface{}) {
+			client.CounterFull(name, value, timestamp, labels)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		end := time.Now()
+		labels := map[string]interface{}{"method": r.Method, "status": strconv.Itoa(recorder.status)}
+		timer("http.request.duration", end.Sub(start).Seconds(), end, labels)
+		counter("http.responses", 1, end, labels)
+	})
+}
+
+// statusRecorder remembers the status code written through it. A handler which never calls WriteHeader
+// responds with 200 OK.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
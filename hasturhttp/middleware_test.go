@@ -0,0 +1,60 @@
+package hasturhttp_test
+
+import (
+	"git.corp.ooyala.com/hastur-go"
+	"git.corp.ooyala.com/hastur-go/hasturhttp"
+
+	"encoding/json"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Hook gocheck into gotest
+func Test(t *testing.T) { TestingT(t) }
+
+type MiddlewareSuite struct{}
+
+var _ = Suite(&MiddlewareSuite{})
+
+func (s *MiddlewareSuite) TestClientMiddleware(c *C) {
+	transport := &hastur.MemoryTransport{}
+	client, err := hastur.NewClient("127.0.0.1", 8125)
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetTransport(transport)
+	handler := hasturhttp.ClientMiddleware(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/missing", nil))
+	c.Check(recorder.Code, Equals, http.StatusNotFound)
+
+	sent := transport.Messages()
+	c.Assert(sent, HasLen, 4)
+	expected := []struct{ messageType, name, method, status string }{
+		{"timer", "http.request.duration", "GET", "200"},
+		{"counter", "http.responses", "GET", "200"},
+		{"timer", "http.request.duration", "POST", "404"},
+		{"counter", "http.responses", "POST", "404"},
+	}
+	for i, e := range expected {
+		var message struct {
+			Type   string
+			Name   string
+			Labels map[string]interface{}
+		}
+		c.Assert(json.Unmarshal(sent[i], &message), IsNil)
+		c.Check(message.Type, Equals, e.messageType)
+		c.Check(message.Name, Equals, e.name)
+		c.Check(message.Labels["method"], Equals, e.method)
+		c.Check(message.Labels["status"], Equals, e.status)
+	}
+}
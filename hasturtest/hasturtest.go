@@ -0,0 +1,87 @@
+/*
+Package hasturtest helps test code which sends Hastur messages.
+
+A Recorder is a hastur.Transport which keeps every message sent through it in memory, decoded and in the
+order sent. Because it records each message before the send returns, assertions made afterward see every
+message without waiting on the network:
+
+	client, recorder := hasturtest.NewClient()
+	client.Counter("requests", 1)
+	messages := recorder.Messages()
+	// messages[0]["name"] == "requests"
+
+To capture the default client's messages, install a Recorder with hastur.SetTransport and remove it with
+hastur.SetTransport(nil) when done. When a client sends asynchronously, call its Flush method before making
+assertions.
+*/
+package hasturtest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"git.corp.ooyala.com/hastur-go"
+)
+
+// Message is a decoded Hastur message, such as {"type": "counter", "name": "requests", "value": 1, ...}.
+// Numbers are decoded as float64.
+type Message map[string]interface{}
+
+// Recorder is a hastur.Transport which records every message sent through it, keeping them in a
+// hastur.MemoryTransport. Messages must be JSON, so the client should use the default encoder without
+// compression. A message which can't be decoded is rejected, and the client counts it as dropped. A Recorder is
+// safe for concurrent use, and the zero value is ready to use.
+type Recorder struct {
+	transport hastur.MemoryTransport
+}
+
+// NewClient returns a client whose messages are sent to a new Recorder. The client never dials the network.
+func NewClient() (*hastur.Client, *Recorder) {
+	recorder := &Recorder{}
+	return hastur.NewClientWithTransport(recorder), recorder
+}
+
+// Capture routes client's messages to a new Recorder, which is returned.
+func Capture(client *hastur.Client) *Recorder {
+	recorder := &Recorder{}
+	client.SetTransport(recorder)
+	return recorder
+}
+
+// Send records message if it can be decoded.
+func (r *Recorder) Send(message []byte) error {
+	if _, err := decode(message); err != nil {
+		return err
+	}
+	return r.transport.Send(message)
+}
+
+// Messages returns the decoded messages recorded so far, oldest first.
+func (r *Recorder) Messages() []Message {
+	raw := r.transport.Messages()
+	messages := make([]Message, 0, len(raw))
+	for _, message := range raw {
+		// Only messages which decoded are recorded, so this can't fail.
+		decoded, _ := decode(message)
+		messages = append(messages, decoded)
+	}
+	return messages
+}
+
+// Raw returns the recorded messages as they were sent, oldest first.
+func (r *Recorder) Raw() [][]byte {
+	return r.transport.Messages()
+}
+
+// Reset discards the recorded messages.
+func (r *Recorder) Reset() {
+	r.transport.Reset()
+}
+
+func decode(message []byte) (Message, error) {
+	decoded := make(Message)
+	if err := json.Unmarshal(message, &decoded); err != nil {
+		return nil, fmt.Errorf("hasturtest: decoding message: %w", err)
+	}
+	return decoded, nil
+}
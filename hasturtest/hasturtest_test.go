@@ -0,0 +1,57 @@
+package hasturtest_test
+
+import (
+	"git.corp.ooyala.com/hastur-go"
+	"git.corp.ooyala.com/hastur-go/hasturtest"
+
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+// Hook gocheck into gotest
+func Test(t *testing.T) { TestingT(t) }
+
+type RecorderSuite struct{}
+
+var _ = Suite(&RecorderSuite{})
+
+func (s *RecorderSuite) TestRecorder(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	for i := 0; i < 100; i++ {
+		client.Counter("test.counter", i)
+	}
+	messages := recorder.Messages()
+	c.Assert(messages, HasLen, 100)
+	for i, message := range messages {
+		c.Check(message["type"], Equals, "counter")
+		c.Check(message["value"], Equals, float64(i))
+	}
+	c.Check(string(recorder.Raw()[0]), Matches, `\{.*"name":"test.counter".*\}`)
+
+	recorder.Reset()
+	c.Check(recorder.Messages(), HasLen, 0)
+	client.Gauge("test.gauge", 1.5)
+	c.Assert(recorder.Messages(), HasLen, 1)
+	c.Check(recorder.Messages()[0]["value"], Equals, 1.5)
+}
+
+func (s *RecorderSuite) TestRecorderAsync(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetAsync(true)
+	client.Mark("test.mark", "queued")
+	client.Flush()
+	c.Assert(recorder.Messages(), HasLen, 1)
+	c.Check(recorder.Messages()[0]["value"], Equals, "queued")
+}
+
+func (s *RecorderSuite) TestRecorderRejectsUndecodable(c *C) {
+	client, recorder := hasturtest.NewClient()
+	defer client.Close()
+	client.SetCompression(hastur.Gzip)
+	client.SetCompressionThreshold(0)
+	client.Mark("test.mark", "compressed")
+	c.Check(recorder.Messages(), HasLen, 0)
+	c.Check(client.DroppedMessagesByReason()[hastur.DropWriteError], Equals, uint64(1))
+}
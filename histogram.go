@@ -0,0 +1,162 @@
+package hastur
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HistogramFull is the same as Histogram but allows for explicit setting of the timestamp and labels.
+func (c *Client) HistogramFull(name string, buckets map[float64]uint64, timestamp time.Time,
+	labels map[string]interface{}) error {
+	return c.histogram(name, buckets, fullOptions(timestamp, labels))
+}
+
+func (c *Client) histogram(name string, buckets map[float64]uint64, o options) error {
+	name, err := c.metricName("histogram", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	// JSON object keys are strings, so the bounds are formatted as the shortest decimal which parses back to
+	// the same value (with the overflow bucket as "+Inf").
+	encoded := make(map[string]uint64, len(buckets))
+	for bound, count := range buckets {
+		encoded[strconv.FormatFloat(bound, 'g', -1, 64)] = count
+	}
+	return c.send(c.buildMessage("histogram", &histogramMessage{Name: name, Buckets: encoded}, o))
+}
+
+// Histogram sends a distribution computed by the program as a single 'histogram' message. buckets maps the
+// upper bound of each bucket to the number of observations in it; use math.Inf(1) as the bound of a bucket for
+// observations above the largest finite bound. This ships a distribution, such as of request latencies,
+// without a message per observation. See HistogramRecorder for a way to accumulate the counts.
+func (c *Client) Histogram(name string, buckets map[float64]uint64, opts ...Option) error {
+	return c.histogram(name, buckets, c.applyOptions(opts))
+}
+
+// HistogramRecorder counts observations in buckets with fixed upper bounds, for sending with SendHistogram.
+// Create one with NewHistogramRecorder. It is safe for concurrent use.
+type HistogramRecorder struct {
+	mutex      sync.Mutex
+	boundaries []float64
+	// counts[i] is the number of observations in the bucket bounded by boundaries[i]. The last count is for
+	// observations above every boundary.
+	counts   []uint64
+	observed bool
+}
+
+// NewHistogramRecorder returns a HistogramRecorder with a bucket for each of boundaries, which needn't be
+// sorted, plus one for larger observations.
+func NewHistogramRecorder(boundaries []float64) *HistogramRecorder {
+	sorted := make([]float64, 0, len(boundaries))
+	for _, boundary := range boundaries {
+		if !math.IsNaN(boundary) && !math.IsInf(boundary, 1) {
+			sorted = append(sorted, boundary)
+		}
+	}
+	sort.Float64s(sorted)
+	unique := sorted[:0]
+	for i, boundary := range sorted {
+		if i == 0 || boundary != sorted[i-1] {
+			unique = append(unique, boundary)
+		}
+	}
+	return &HistogramRecorder{boundaries: unique, counts: make([]uint64, len(unique)+1)}
+}
+
+// Observe counts value in the first bucket whose upper bound is at least value. NaN is ignored.
+func (h *HistogramRecorder) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	i := sort.SearchFloat64s(h.boundaries, value)
+	h.mutex.Lock()
+	h.counts[i]++
+	h.observed = true
+	h.mutex.Unlock()
+}
+
+// Buckets returns the counts observed since the recorder was created or last sent, keyed by upper bound as
+// for Histogram.
+func (h *HistogramRecorder) Buckets() map[float64]uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.buckets(h.counts)
+}
+
+// Return a copy of the counts and reset them, reporting whether there were any observations.
+func (h *HistogramRecorder) take() ([]uint64, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.observed {
+		return nil, false
+	}
+	counts := append([]uint64(nil), h.counts...)
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.observed = false
+	return counts, true
+}
+
+// Add back counts returned by take, which couldn't be sent, to any observed since.
+func (h *HistogramRecorder) restore(counts []uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, count := range counts {
+		h.counts[i] += count
+	}
+	h.observed = true
+}
+
+// Key counts by upper bound, as for Histogram.
+func (h *HistogramRecorder) buckets(counts []uint64) map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(counts))
+	for i, boundary := range h.boundaries {
+		buckets[boundary] = counts[i]
+	}
+	buckets[math.Inf(1)] = counts[len(h.boundaries)]
+	return buckets
+}
+
+// SendHistogram sends the counts accumulated by recorder as a histogram named name and resets them. Nothing is
+// sent, and the counts are kept, if there have been no observations since the last send or the client is
+// disabled. If the histogram is filtered, rate-limited, or fails to send, the error is returned and the counts
+// are kept, to be sent with the next call. (When sending asynchronously, only a failure to queue the histogram
+// is known here.) It is meant to be called periodically, for instance from an Every callback.
+func (c *Client) SendHistogram(name string, recorder *HistogramRecorder, opts ...Option) error {
+	if c.disabled.Load() {
+		return nil
+	}
+	counts, ok := recorder.take()
+	if !ok {
+		return nil
+	}
+	err := c.Histogram(name, recorder.buckets(counts), opts...)
+	if err != nil {
+		recorder.restore(counts)
+	}
+	return err
+}
+
+// HistogramFull is the same as Histogram but allows for explicit setting of the timestamp and labels.
+func HistogramFull(name string, buckets map[float64]uint64, timestamp time.Time, labels map[string]interface{}) {
+	defaultClient.HistogramFull(name, buckets, timestamp, labels)
+}
+
+// Histogram sends a distribution as one message using the default client. See Client.Histogram.
+func Histogram(name string, buckets map[float64]uint64, opts ...Option) {
+	defaultClient.Histogram(name, buckets, opts...)
+}
+
+// SendHistogram sends and resets the counts accumulated by recorder using the default client. For example:
+//
+//	latency := hastur.NewHistogramRecorder([]float64{0.01, 0.1, 1})
+//	hastur.Every(hastur.Minute, func() { hastur.SendHistogram("api.latency", latency) })
+//
+// See Client.SendHistogram.
+func SendHistogram(name string, recorder *HistogramRecorder, opts ...Option) {
+	defaultClient.SendHistogram(name, recorder, opts...)
+}
@@ -0,0 +1,240 @@
+package hastur
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Labels builds a label map without spelling out a map literal:
+//
+//	hastur.CounterFull("requests", 1, time.Now(), hastur.NewLabels().Set("region", "us").Set("az", "a"))
+//
+// Since a Labels is a map[string]interface{}, it can be passed anywhere labels are accepted, including to the
+// *Full methods and WithLabels.
+type Labels map[string]interface{}
+
+// NewLabels returns an empty Labels.
+func NewLabels() Labels {
+	return make(Labels)
+}
+
+// Set sets a label and returns l, so that calls can be chained.
+func (l Labels) Set(key string, value interface{}) Labels {
+	l[key] = value
+	return l
+}
+
+// Merge copies every label in labels into l, replacing labels with the same key, and returns l.
+func (l Labels) Merge(labels map[string]interface{}) Labels {
+	for key, value := range labels {
+		l[key] = value
+	}
+	return l
+}
+
+// Return a shallow copy of a label (or tag) map, which is never nil.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+	return result
+}
+
+// LabelMergeStrategy controls how a message's own labels are combined with the default labels (see
+// SetLabelMergeStrategy).
+type LabelMergeStrategy int
+
+const (
+	// CallerWins sends the default labels along with the message's labels, and where both have a label with
+	// the same key, sends the message's. This is the default.
+	CallerWins LabelMergeStrategy = iota
+	// DefaultsWin sends the default labels along with the message's labels, and where both have a label with
+	// the same key, sends the default. Before CallerWins became the default, this was the only behavior.
+	DefaultsWin
+	// CallerOnly sends only the message's labels, without any default labels (including "app", "pid", and
+	// "host").
+	CallerOnly
+)
+
+// SetLabelMergeStrategy sets how the labels given for each message are combined with the default labels.
+// By default (CallerWins), a message label replaces a default label with the same key, so for instance a
+// message may give its own "app" label; DefaultsWin reverses this. To send messages on behalf of another
+// service with exactly the labels given, use a separate client with CallerOnly.
+func (c *Client) SetLabelMergeStrategy(strategy LabelMergeStrategy) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.labelMerge = strategy
+}
+
+// SetLabelMergeStrategy sets how the default client combines message labels with the default labels. See
+// Client.SetLabelMergeStrategy.
+func SetLabelMergeStrategy(strategy LabelMergeStrategy) {
+	defaultClient.SetLabelMergeStrategy(strategy)
+}
+
+// SetStrictLabels controls what happens to a message with a label value which can't be encoded (such as a
+// channel). In strict mode, the default, the whole message fails to encode and is dropped, as described under
+// MarshalError. Otherwise each label value is checked, without encoding it, for channels, functions, complex
+// numbers, and unsafe pointers, including inside maps, slices, pointers, and structs. Complex numbers are sent
+// as strings, such as "(1+2i)". Labels containing anything else on that list are removed before sending, and
+// their names are listed, comma-separated, under a "label_error" label so the problem stays visible. Values
+// which can't be encoded for other reasons, such as a NaN float, still cause the message to fail.
+func (c *Client) SetStrictLabels(strict bool) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.strictLabels = strict
+}
+
+// Unless in strict mode, stringify complex label values and remove labels whose values can't be encoded,
+// recording their names under "label_error". labels is not modified; a copy is returned if any label changes.
+func (c *Client) checkLabels(labels map[string]interface{}) map[string]interface{} {
+	c.configMutex.RLock()
+	strict := c.strictLabels
+	c.configMutex.RUnlock()
+	if strict {
+		return labels
+	}
+	var invalid, complexes []string
+	for label, value := range labels {
+		switch value.(type) {
+		case complex64, complex128:
+			complexes = append(complexes, label)
+			continue
+		}
+		if unencodable(reflect.ValueOf(value), 0) {
+			invalid = append(invalid, label)
+		}
+	}
+	if len(invalid) == 0 && len(complexes) == 0 {
+		return labels
+	}
+	checked := copyMap(labels)
+	for _, label := range complexes {
+		checked[label] = fmt.Sprint(labels[label])
+	}
+	for _, label := range invalid {
+		delete(checked, label)
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		checked["label_error"] = strings.Join(invalid, ",")
+	}
+	return checked
+}
+
+// How deeply unencodable looks inside nested values; anything deeper is left to the encoder.
+const maxLabelDepth = 16
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Report whether v is or contains a channel, function, complex number, or unsafe pointer, none of which can be
+// encoded as JSON, unless it encodes itself.
+func unencodable(v reflect.Value, depth int) bool {
+	if !v.IsValid() || depth > maxLabelDepth {
+		return false
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return true
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil() && unencodable(v.Elem(), depth+1)
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if unencodable(iter.Value(), depth+1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if unencodable(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && unencodable(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetStrictLabels controls whether the default client drops messages with labels which can't be encoded. See
+// Client.SetStrictLabels.
+func SetStrictLabels(strict bool) {
+	defaultClient.SetStrictLabels(strict)
+}
+
+// SetFlattenLabels controls whether nested maps in labels are flattened into keys joined by the label
+// separator (see SetLabelSeparator), for agents which don't handle nested labels. For example,
+// {"a": {"b": 1}} becomes {"a.b": 1}. Values other than maps are left alone. Flattening is off by default.
+func (c *Client) SetFlattenLabels(enabled bool) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.flattenLabels = enabled
+}
+
+// SetLabelSeparator sets the string used to join keys when flattening labels. The default is ".".
+func (c *Client) SetLabelSeparator(separator string) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.labelSeparator = separator
+}
+
+// Flatten nested maps in labels, if enabled.
+func (c *Client) flatten(labels map[string]interface{}) map[string]interface{} {
+	c.configMutex.RLock()
+	enabled, separator := c.flattenLabels, c.labelSeparator
+	c.configMutex.RUnlock()
+	if !enabled {
+		return labels
+	}
+	flat := make(map[string]interface{}, len(labels))
+	flattenInto(flat, "", separator, labels)
+	return flat
+}
+
+// Add the entries of labels to flat, with keys prefixed by prefix, descending into nested maps.
+func flattenInto(flat map[string]interface{}, prefix, separator string, labels map[string]interface{}) {
+	for key, value := range labels {
+		if prefix != "" {
+			key = prefix + separator + key
+		}
+		switch nested := value.(type) {
+		case map[string]interface{}:
+			flattenInto(flat, key, separator, nested)
+		case Labels:
+			flattenInto(flat, key, separator, nested)
+		case map[string]string:
+			for nestedKey, nestedValue := range nested {
+				flat[key+separator+nestedKey] = nestedValue
+			}
+		default:
+			flat[key] = value
+		}
+	}
+}
+
+// SetFlattenLabels controls whether the default client flattens nested label maps. See
+// Client.SetFlattenLabels.
+func SetFlattenLabels(enabled bool) {
+	defaultClient.SetFlattenLabels(enabled)
+}
+
+// SetLabelSeparator sets the string the default client uses to join keys when flattening labels.
+func SetLabelSeparator(separator string) {
+	defaultClient.SetLabelSeparator(separator)
+}
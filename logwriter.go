@@ -0,0 +1,69 @@
+package hastur
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// A writer which forwards each line written to it as a log message.
+type logWriter struct {
+	client *Client
+	labels map[string]interface{}
+
+	mutex   sync.Mutex
+	partial []byte
+}
+
+// NewLogWriter returns a writer which sends each line written to it to Hastur as a log message with the
+// given labels, using the line as the subject. It can be passed to log.New or log.SetOutput to mirror an
+// existing logger to Hastur:
+//
+//	logger := log.New(io.MultiWriter(os.Stderr, client.NewLogWriter(nil)), "", 0)
+//
+// Output is split on newlines, and a trailing partial line is held until the rest of it is written. Empty
+// lines are skipped. Lines written from within the client's error handler are discarded, so that a handler
+// which logs through the same logger can't recurse; lines written by other goroutines meanwhile are sent. The
+// writer is safe for concurrent use.
+func (c *Client) NewLogWriter(labels map[string]interface{}) io.Writer {
+	copied := make(map[string]interface{}, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return &logWriter{client: c, labels: copied}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if w.client.inErrorHandler() {
+		return len(p), nil
+	}
+	w.mutex.Lock()
+	w.partial = append(w.partial, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(w.partial[:i], []byte("\r"))
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.partial) == 0 {
+		w.partial = nil
+	}
+	w.mutex.Unlock()
+
+	for _, line := range lines {
+		w.client.LogFull(line, nil, w.client.clock.Now(), w.labels)
+	}
+	return len(p), nil
+}
+
+// NewLogWriter returns a writer which sends each line written to it as a log message using the default
+// client. See Client.NewLogWriter.
+func NewLogWriter(labels map[string]interface{}) io.Writer {
+	return defaultClient.NewLogWriter(labels)
+}
@@ -0,0 +1,160 @@
+package hastur
+
+// The message types are marshalled from the structs below. Their fields are declared in alphabetical order of
+// their keys, the same order encoding/json uses for maps, so the encoded form is the same as for a map with the
+// same keys. The embedded handlerMark has no exported fields and isn't encoded.
+
+// message is implemented by each message struct.
+type message interface {
+	// setHeader sets the fields common to every message.
+	setHeader(messageType string, timestamp int64, labels, tags map[string]interface{})
+	messageType() string
+	markSentByHandler()
+	sentByHandler() bool
+}
+
+// handlerMark records that a message was sent from within the error handler, so that its failure isn't passed
+// back to the handler (see callErrorHandler).
+type handlerMark struct {
+	fromHandler bool
+}
+
+func (h *handlerMark) markSentByHandler() { h.fromHandler = true }
+
+func (h *handlerMark) sentByHandler() bool { return h.fromHandler }
+
+// A mark, set, counter, gauge, or timer.
+type statMessage[V any] struct {
+	handlerMark
+	Labels     map[string]interface{} `json:"labels"`
+	Name       string                 `json:"name"`
+	SampleRate float64                `json:"sample_rate,omitempty"`
+	Tags       map[string]interface{} `json:"tags,omitempty"`
+	Timestamp  int64                  `json:"timestamp"`
+	Type       string                 `json:"type"`
+	Value      V                      `json:"value"`
+}
+
+func (m *statMessage[V]) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *statMessage[V]) messageType() string { return m.Type }
+
+// A compound message, holding several related values.
+type compoundMessage struct {
+	handlerMark
+	Labels    map[string]interface{} `json:"labels"`
+	Name      string                 `json:"name"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Values    map[string]float64     `json:"values"`
+}
+
+func (m *compoundMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *compoundMessage) messageType() string { return m.Type }
+
+// A histogram, holding the number of observations in each bucket keyed by the bucket's upper bound.
+type histogramMessage struct {
+	handlerMark
+	Buckets   map[string]uint64      `json:"buckets"`
+	Labels    map[string]interface{} `json:"labels"`
+	Name      string                 `json:"name"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+}
+
+func (m *histogramMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *histogramMessage) messageType() string { return m.Type }
+
+type eventMessage struct {
+	handlerMark
+	Attn      []string               `json:"attn"`
+	Body      string                 `json:"body"`
+	ID        string                 `json:"id"`
+	Labels    map[string]interface{} `json:"labels"`
+	Name      string                 `json:"name"`
+	Subject   string                 `json:"subject"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+}
+
+func (m *eventMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *eventMessage) messageType() string { return m.Type }
+
+type logMessage struct {
+	handlerMark
+	Data      interface{}            `json:"data"`
+	Labels    map[string]interface{} `json:"labels"`
+	Subject   string                 `json:"subject"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+}
+
+func (m *logMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *logMessage) messageType() string { return m.Type }
+
+type registrationMessage struct {
+	handlerMark
+	Data      map[string]interface{} `json:"data"`
+	Labels    map[string]interface{} `json:"labels"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+}
+
+func (m *registrationMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *registrationMessage) messageType() string { return m.Type }
+
+// An info_process or info_agent message.
+type infoMessage struct {
+	handlerMark
+	Data      map[string]interface{} `json:"data"`
+	Labels    map[string]interface{} `json:"labels"`
+	Tag       string                 `json:"tag"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+}
+
+func (m *infoMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *infoMessage) messageType() string { return m.Type }
+
+type heartbeatMessage struct {
+	handlerMark
+	Labels    map[string]interface{} `json:"labels"`
+	Name      string                 `json:"name"`
+	Timeout   float64                `json:"timeout"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Value     float64                `json:"value"`
+}
+
+func (m *heartbeatMessage) setHeader(messageType string, timestamp int64, labels, tags map[string]interface{}) {
+	m.Type, m.Timestamp, m.Labels, m.Tags = messageType, timestamp, labels, tags
+}
+
+func (m *heartbeatMessage) messageType() string { return m.Type }
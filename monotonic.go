@@ -0,0 +1,85 @@
+package hastur
+
+import (
+	"fmt"
+)
+
+// MonotonicGaugeSamples is the number of consecutive increases after which a gauge is reported as looking like
+// a counter (see SetGaugeMonotonicWarn).
+const MonotonicGaugeSamples = 20
+
+// MonotonicGaugeWarning is passed to the error handler when a gauge's value has only ever increased (see
+// SetGaugeMonotonicWarn). It doesn't mean a message failed to send.
+type MonotonicGaugeWarning struct {
+	// Name is the name of the gauge, including any prefix.
+	Name string
+	// Samples is the number of consecutive increases seen.
+	Samples int
+}
+
+func (w *MonotonicGaugeWarning) Error() string {
+	return fmt.Sprintf("hastur: gauge %q has increased %d times in a row; should it be a counter?", w.Name,
+		w.Samples)
+}
+
+// The values seen of a gauge tracked by SetGaugeMonotonicWarn.
+type gaugeHistory struct {
+	last      float64
+	increases int
+	warned    bool
+}
+
+// SetGaugeMonotonicWarn turns on a check, meant for development, for totals mistakenly sent as gauges rather
+// than counters. The client remembers the last value of each gauge, and the first time one has increased
+// MonotonicGaugeSamples times in a row it passes a *MonotonicGaugeWarning to the error handler (the default
+// handler logs it), once per gauge. The gauges are still sent. The library's own totals sent as gauges, such as
+// those of StartSelfMetrics and StartUptimeMetric, aren't checked.
+//
+// The check is off by default, since it costs a map lookup per gauge. It is switched on at run time rather than
+// compiled in only for debug builds: when off it costs a single atomic load, so a build tag would save nothing
+// while leaving the check untested in normal builds. Programs which want it only in debug builds can call
+// SetGaugeMonotonicWarn from a file with their own build constraint.
+func (c *Client) SetGaugeMonotonicWarn(enabled bool) {
+	c.gaugesMutex.Lock()
+	defer c.gaugesMutex.Unlock()
+	c.gauges = nil
+	c.gaugeMonotonicWarn.Store(enabled)
+}
+
+// Track a gauge's value and warn if it has only increased lately, if SetGaugeMonotonicWarn is on. Every gauge,
+// sampled or not, is checked here.
+func (c *Client) checkMonotonic(name string, value float64, m message) {
+	if !c.gaugeMonotonicWarn.Load() {
+		return
+	}
+	c.gaugesMutex.Lock()
+	if c.gauges == nil {
+		c.gauges = make(map[string]*gaugeHistory)
+	}
+	history, ok := c.gauges[name]
+	if !ok {
+		c.gauges[name] = &gaugeHistory{last: value}
+		c.gaugesMutex.Unlock()
+		return
+	}
+	if value > history.last {
+		history.increases++
+	} else {
+		history.increases = 0
+	}
+	history.last = value
+	warn := !history.warned && history.increases >= MonotonicGaugeSamples
+	if warn {
+		history.warned = true
+	}
+	c.gaugesMutex.Unlock()
+	if warn {
+		c.callErrorHandler(&MonotonicGaugeWarning{Name: name, Samples: MonotonicGaugeSamples}, m)
+	}
+}
+
+// SetGaugeMonotonicWarn turns on warnings for gauges of the default client which only increase. See
+// Client.SetGaugeMonotonicWarn.
+func SetGaugeMonotonicWarn(enabled bool) {
+	defaultClient.SetGaugeMonotonicWarn(enabled)
+}
@@ -0,0 +1,51 @@
+package hastur
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidName is returned (wrapped with the offending name) when a message with an invalid name is sent
+// in strict mode. See SetStrictNames.
+var ErrInvalidName = errors.New("hastur: invalid message name")
+
+// Whether r may appear in a message name.
+func validNameRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'
+}
+
+// Whether name is a non-empty string of valid name characters.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !validNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Replace each invalid character of name with an underscore. An empty name becomes "_".
+func sanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if validNameRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// SetStrictNames controls how message names are validated. Names may contain only ASCII letters, digits, '.',
+// '_', and '-', and must not be empty. By default, each disallowed character is replaced with '_' (and an
+// empty name becomes "_"). In strict mode, a message with an invalid name is dropped instead and the message
+// method returns an error wrapping ErrInvalidName. The name prefix (see SetPrefix) is not validated.
+func (c *Client) SetStrictNames(strict bool) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.strictNames = strict
+}
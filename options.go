@@ -0,0 +1,75 @@
+package hastur
+
+import (
+	"time"
+)
+
+// Option customizes a single message sent with one of the short-form message methods, such as Counter or
+// Mark. Options give the short forms the flexibility of the *Full methods without having to spell out every
+// argument:
+//
+//	hastur.Counter("requests", 1, hastur.WithLabels(map[string]interface{}{"region": "us"}))
+type Option func(*options)
+
+// The settings an Option may change, which are passed on to buildMessage.
+type options struct {
+	timestamp time.Time
+	labels    map[string]interface{}
+	tags      map[string]interface{}
+	// internal is set for the library's own metrics, such as StartSelfMetrics's totals, which are sent as gauges
+	// but only increase; they skip SetGaugeMonotonicWarn's check.
+	internal bool
+}
+
+// WithTimestamp sets the timestamp of the message. The default is the current time.
+func WithTimestamp(timestamp time.Time) Option {
+	return func(o *options) { o.timestamp = timestamp }
+}
+
+// WithLabels adds labels to the message. If given more than once, the labels are combined.
+func WithLabels(labels map[string]interface{}) Option {
+	return func(o *options) {
+		for key, value := range labels {
+			o.setLabel(key, value)
+		}
+	}
+}
+
+// WithTags adds tags to the message (see AddDefaultTags). If given more than once, the tags are combined.
+func WithTags(tags map[string]interface{}) Option {
+	return func(o *options) {
+		if o.tags == nil {
+			o.tags = make(map[string]interface{})
+		}
+		for key, value := range tags {
+			o.tags[key] = value
+		}
+	}
+}
+
+// Resolve opts into the timestamp, labels, and tags for a message.
+func (c *Client) applyOptions(opts []Option) options {
+	o := options{timestamp: c.clock.Now()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// The options for one of the library's own metrics, sent at the current time.
+func (c *Client) internalOptions() options {
+	return options{timestamp: c.clock.Now(), internal: true}
+}
+
+// The options for a message sent with one of the *Full methods, which have no tags.
+func fullOptions(timestamp time.Time, labels map[string]interface{}) options {
+	return options{timestamp: timestamp, labels: labels}
+}
+
+// Set a label, creating the labels map on first use; most messages have no labels of their own.
+func (o *options) setLabel(key string, value interface{}) {
+	if o.labels == nil {
+		o.labels = make(map[string]interface{})
+	}
+	o.labels[key] = value
+}
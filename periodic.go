@@ -0,0 +1,53 @@
+package hastur
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GaugeFunc calls fn at the given interval and sends the value it returns as a gauge named name. Call Stop on
+// the returned Stopper to halt it.
+func (c *Client) GaugeFunc(name string, interval Interval, fn func() float64) Stopper {
+	return c.gaugeFunc(name, funcInterval("GaugeFunc", interval), fn)
+}
+
+// CounterFunc reports a monotonically increasing source, such as a total number of requests served, as a
+// counter. It calls fn once right away and then at the given interval, sending the difference between each
+// value and the one before as a counter named name. Call Stop on the returned Stopper to halt it.
+func (c *Client) CounterFunc(name string, interval Interval, fn func() int64) Stopper {
+	return c.counterFunc(name, funcInterval("CounterFunc", interval), fn)
+}
+
+func funcInterval(caller string, interval Interval) time.Duration {
+	duration, ok := intervalToDuration[interval]
+	if !ok {
+		panic(fmt.Sprintf("%s called with bad interval.", caller))
+	}
+	return duration
+}
+
+func (c *Client) gaugeFunc(name string, duration time.Duration, fn func() float64) Stopper {
+	return every(context.Background(), c, duration, false, func() { c.Gauge(name, fn()) })
+}
+
+func (c *Client) counterFunc(name string, duration time.Duration, fn func() int64) Stopper {
+	last := fn()
+	return every(context.Background(), c, duration, false, func() {
+		current := fn()
+		c.CounterInt64(name, current-last)
+		last = current
+	})
+}
+
+// GaugeFunc periodically sends the value returned by fn as a gauge using the default client. See
+// Client.GaugeFunc.
+func GaugeFunc(name string, interval Interval, fn func() float64) Stopper {
+	return defaultClient.GaugeFunc(name, interval, fn)
+}
+
+// CounterFunc periodically sends the change in the value returned by fn as a counter using the default
+// client. See Client.CounterFunc.
+func CounterFunc(name string, interval Interval, fn func() int64) Stopper {
+	return defaultClient.CounterFunc(name, interval, fn)
+}
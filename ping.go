@@ -0,0 +1,52 @@
+package hastur
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// PingTimeout bounds how long Ping waits to connect.
+const PingTimeout = 2 * time.Second
+
+// SetHealthPort sets a TCP port on the agent's address which Ping probes to confirm the agent is up. A port of
+// zero (the default) means there is none.
+func (c *Client) SetHealthPort(port int) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.healthPort = port
+}
+
+// Ping checks that the agent is reachable, for instance as part of a readiness check. If a health port is set
+// (see SetHealthPort), Ping connects to it over TCP. Otherwise it dials a fresh connection to the agent, which
+// confirms the agent is accepting connections over a stream network such as TCP; over UDP, it only confirms
+// that the address resolves and a socket can be opened. Ping returns ErrClosed if the client is closed.
+func (c *Client) Ping() error {
+	c.connMutex.RLock()
+	closed, network, address := c.closed, c.network, net.JoinHostPort(c.udpAddress, strconv.Itoa(c.udpPort))
+	if c.isUnix() {
+		address = c.socketPath
+	}
+	if c.healthPort > 0 {
+		network, address = "tcp", net.JoinHostPort(c.udpAddress, strconv.Itoa(c.healthPort))
+	}
+	c.connMutex.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	conn, err := net.DialTimeout(network, address, PingTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// SetHealthPort sets the TCP port the default client's Ping probes. See Client.SetHealthPort.
+func SetHealthPort(port int) {
+	defaultClient.SetHealthPort(port)
+}
+
+// Ping checks that the default client's agent is reachable. See Client.Ping.
+func Ping() error {
+	return defaultClient.Ping()
+}
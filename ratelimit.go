@@ -0,0 +1,106 @@
+package hastur
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRateLimited is returned when a message is dropped for exceeding a rate limit (see SetRateLimit).
+var ErrRateLimited = errors.New("hastur: rate limit exceeded")
+
+// A token bucket holding up to one second's worth of messages.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// Add the tokens earned since the bucket was last refilled, up to time now.
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// SetRateLimit limits the messages sent with the given name (as passed to the message methods, before any
+// prefix is applied) to maxPerSecond, allowing bursts of up to maxPerSecond messages. Messages over the limit
+// are dropped, counted with DropRateLimited, and the message method returns ErrRateLimited. A limit of zero or
+// less removes the limit for name.
+func (c *Client) SetRateLimit(name string, maxPerSecond int) {
+	c.rateMutex.Lock()
+	defer c.rateMutex.Unlock()
+	defer c.updateRateLimitedLocked()
+	if maxPerSecond <= 0 {
+		delete(c.rateLimits, name)
+		return
+	}
+	if c.rateLimits == nil {
+		c.rateLimits = make(map[string]*bucket)
+	}
+	c.rateLimits[name] = c.newBucket(maxPerSecond)
+}
+
+// SetGlobalRateLimit is the same as SetRateLimit but limits all messages sent by the client together,
+// whatever their name.
+func (c *Client) SetGlobalRateLimit(maxPerSecond int) {
+	c.rateMutex.Lock()
+	defer c.rateMutex.Unlock()
+	c.globalRateLimit = nil
+	if maxPerSecond > 0 {
+		c.globalRateLimit = c.newBucket(maxPerSecond)
+	}
+	c.updateRateLimitedLocked()
+}
+
+// Record whether any rate limit is set. The caller must hold rateMutex.
+func (c *Client) updateRateLimitedLocked() {
+	c.rateLimited.Store(c.globalRateLimit != nil || len(c.rateLimits) > 0)
+}
+
+func (c *Client) newBucket(maxPerSecond int) *bucket {
+	return &bucket{rate: float64(maxPerSecond), tokens: float64(maxPerSecond), last: c.clock.Now()}
+}
+
+// Report whether a message named name (or, if name is empty, an unnamed message such as a log line) is within
+// both its own rate limit and the global one, counting it as a drop if not. A message is charged a token by
+// both limits or by neither.
+func (c *Client) allow(name string) bool {
+	if !c.rateLimited.Load() {
+		return true
+	}
+	c.rateMutex.Lock()
+	defer c.rateMutex.Unlock()
+	limits := [2]*bucket{c.globalRateLimit}
+	if name != "" {
+		limits[1] = c.rateLimits[name]
+	}
+	now := c.clock.Now()
+	for _, limit := range limits {
+		if limit == nil {
+			continue
+		}
+		limit.refill(now)
+		if limit.tokens < 1 {
+			c.drop(DropRateLimited)
+			return false
+		}
+	}
+	for _, limit := range limits {
+		if limit != nil {
+			limit.tokens--
+		}
+	}
+	return true
+}
+
+// SetRateLimit limits the rate of the default client's messages with the given name. See Client.SetRateLimit.
+func SetRateLimit(name string, maxPerSecond int) {
+	defaultClient.SetRateLimit(name, maxPerSecond)
+}
+
+// SetGlobalRateLimit limits the rate of all of the default client's messages. See Client.SetGlobalRateLimit.
+func SetGlobalRateLimit(maxPerSecond int) {
+	defaultClient.SetGlobalRateLimit(maxPerSecond)
+}
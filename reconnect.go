@@ -0,0 +1,93 @@
+package hastur
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// DefaultReconnectMin is the initial delay between reconnection attempts unless changed with
+	// SetReconnectBackoff.
+	DefaultReconnectMin = 100 * time.Millisecond
+	// DefaultReconnectMax is the maximum delay between reconnection attempts unless changed with
+	// SetReconnectBackoff.
+	DefaultReconnectMax = time.Minute
+	// DefaultDialTimeout bounds each attempt to connect unless changed with SetDialTimeout.
+	DefaultDialTimeout = 5 * time.Second
+)
+
+// SetDialTimeout bounds how long each attempt to connect to the agent (or to an additional destination) may
+// take, so that an unreachable host over a stream network fails fast instead of holding up the caller. A
+// timeout of zero means dials never time out. The timeout applies to later dials, such as reconnections or
+// those made by SetNetwork or SetUdpAddress; the default client's first dial, made when the package is
+// initialized, uses DefaultDialTimeout.
+func (c *Client) SetDialTimeout(timeout time.Duration) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.dialTimeout = timeout
+}
+
+// SetReconnectBackoff sets the delays used when re-dialing after a failed dial or write. When a write fails,
+// the next send re-dials the destination. If writes keep failing, each further attempt waits twice as long as the
+// previous one, starting at min and never exceeding max. A successful write resets the backoff.
+func (c *Client) SetReconnectBackoff(min, max time.Duration) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.reconnectMin = min
+	c.reconnectMax = max
+	if c.reconnectDelay > max {
+		c.reconnectDelay = max
+	}
+}
+
+// Record that a write on conn failed so the next send after the backoff re-dials.
+func (c *Client) connFailed(conn net.Conn) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if c.broken || c.closed || c.conn != conn {
+		return
+	}
+	c.broken = true
+	c.scheduleReconnect()
+}
+
+// Record that a write on conn succeeded after earlier failures, resetting the backoff.
+func (c *Client) connRecovered(conn net.Conn) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if c.conn == conn {
+		c.reconnectDelay = 0
+	}
+}
+
+// Re-dial the destination if the connection is still broken and the backoff has elapsed. The previous
+// connection is kept if the dial fails.
+func (c *Client) reconnect() {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if !c.broken || c.closed || c.externalConn || time.Now().Before(c.nextReconnect) {
+		return
+	}
+	conn, err := c.dial()
+	if err != nil {
+		c.scheduleReconnect()
+		return
+	}
+	c.releaseConn()
+	c.conn = conn
+	c.broken = false
+	c.reconnects.Add(1)
+}
+
+// Set the time of the next reconnection attempt and grow the backoff. The caller must hold connMutex.
+func (c *Client) scheduleReconnect() {
+	c.nextReconnect = time.Now().Add(c.reconnectDelay)
+	switch {
+	case c.reconnectDelay == 0:
+		c.reconnectDelay = c.reconnectMin
+	case c.reconnectDelay*2 > c.reconnectMax:
+		c.reconnectDelay = c.reconnectMax
+	default:
+		c.reconnectDelay *= 2
+	}
+}
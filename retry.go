@@ -0,0 +1,82 @@
+package hastur
+
+import (
+	"errors"
+	"time"
+)
+
+// SetEventRetry turns on retrying of events until the agent acknowledges them (see EventAck), for
+// at-least-once delivery. Each event is sent up to attempts times in all: if no acknowledgement arrives within
+// backoff of the first send, the event is sent again, and the wait doubles after each further attempt. The
+// retries happen in the background, so Event and EventFull still return after the first send. Retries and
+// events given up on are counted in Stats.
+//
+// Acknowledgements require a stream network, so events sent over UDP or through a Transport are never
+// retried. An attempts value of 1 or less turns retrying off, which is the default. Other messages are never
+// retried.
+func (c *Client) SetEventRetry(attempts int, backoff time.Duration) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.eventAttempts = attempts
+	c.eventBackoff = backoff
+}
+
+// Send an event, then retry it in the background until it is acknowledged, if retrying is enabled and
+// possible.
+func (c *Client) sendEvent(id string, m message) error {
+	c.configMutex.RLock()
+	attempts, backoff := c.eventAttempts, c.eventBackoff
+	c.configMutex.RUnlock()
+	c.connMutex.RLock()
+	conn, supported := c.conn, c.isStream() && c.transport == nil
+	c.connMutex.RUnlock()
+	if attempts <= 1 || !supported {
+		return c.send(m)
+	}
+	acked := c.expectAck(id, conn)
+	err := c.send(m)
+	if errors.Is(err, ErrClosed) {
+		c.forgetAck(id)
+		return err
+	}
+	go c.retryEvent(id, m, acked, attempts-1, backoff)
+	return err
+}
+
+// Resend an event each time backoff passes without an acknowledgement, doubling backoff each time, until it is
+// acknowledged or has been resent retries times.
+func (c *Client) retryEvent(id string, m message, acked chan struct{}, retries int, backoff time.Duration) {
+	defer c.forgetAck(id)
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-acked:
+			return
+		case <-timer.C:
+		}
+		if retries == 0 {
+			c.eventGiveUps.Add(1)
+			return
+		}
+		retries--
+		c.eventRetries.Add(1)
+		// The connection may have been replaced since the last send; make sure its acknowledgements are read.
+		c.connMutex.RLock()
+		conn := c.conn
+		c.connMutex.RUnlock()
+		c.expectAck(id, conn)
+		if errors.Is(c.send(m), ErrClosed) {
+			c.eventGiveUps.Add(1)
+			return
+		}
+		backoff *= 2
+		timer.Reset(backoff)
+	}
+}
+
+// SetEventRetry turns on retrying of the default client's events until they are acknowledged. See
+// Client.SetEventRetry.
+func SetEventRetry(attempts int, backoff time.Duration) {
+	defaultClient.SetEventRetry(attempts, backoff)
+}
@@ -0,0 +1,55 @@
+package hastur
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// StartRuntimeMetrics reports Go runtime statistics as gauges at the given interval: "go.heap_alloc" (bytes),
+// "go.num_goroutine", "go.num_gc" (collections since the process started), and "go.gc_pause" (seconds spent
+// paused for garbage collection since the previous report). Call Stop on the returned Stopper to halt
+// reporting.
+func (c *Client) StartRuntimeMetrics(interval Interval) Stopper {
+	var last runtime.MemStats
+	runtime.ReadMemStats(&last)
+	duration := funcInterval("StartRuntimeMetrics", interval)
+	return every(context.Background(), c, duration, false, func() { c.reportRuntimeMetrics(&last) })
+}
+
+// Report the current runtime statistics, with the GC pause measured since last, and update last.
+func (c *Client) reportRuntimeMetrics(last *runtime.MemStats) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	err := sendBatch(c, "gauge", map[string]float64{
+		"go.heap_alloc":    float64(stats.HeapAlloc),
+		"go.num_goroutine": float64(runtime.NumGoroutine()),
+		"go.num_gc":        float64(stats.NumGC),
+		"go.gc_pause":      time.Duration(stats.PauseTotalNs - last.PauseTotalNs).Seconds(),
+	}, c.internalOptions())
+	*last = stats
+	return err
+}
+
+// StartUptimeMetric reports the time since the process started, in seconds, as a gauge named
+// "process.uptime_seconds" at the given interval. The start is taken to be when this package was initialized.
+// Call Stop on the returned Stopper to halt reporting.
+func (c *Client) StartUptimeMetric(interval Interval) Stopper {
+	duration := funcInterval("StartUptimeMetric", interval)
+	return every(context.Background(), c, duration, false, func() { c.reportUptime() })
+}
+
+func (c *Client) reportUptime() error {
+	return gaugeFull(c, "process.uptime_seconds", c.clock.Now().Sub(processStart).Seconds(), c.internalOptions())
+}
+
+// StartRuntimeMetrics reports Go runtime statistics with the default client. See
+// Client.StartRuntimeMetrics.
+func StartRuntimeMetrics(interval Interval) Stopper {
+	return defaultClient.StartRuntimeMetrics(interval)
+}
+
+// StartUptimeMetric reports the process uptime with the default client. See Client.StartUptimeMetric.
+func StartUptimeMetric(interval Interval) Stopper {
+	return defaultClient.StartUptimeMetric(interval)
+}
@@ -0,0 +1,92 @@
+package hastur
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Report whether a message sampled at rate should be sent.
+func (c *Client) sample(rate float64) bool {
+	c.rngMutex.Lock()
+	defer c.rngMutex.Unlock()
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return c.rng.Float64() < rate
+}
+
+// CounterSampled is the same as Counter, but only sends the message with probability rate (between 0.0 and
+// 1.0). Sent messages include a "sample_rate" field so the agent can scale the counter back up. With a rate of
+// 1.0 or more this is identical to Counter.
+func (c *Client) CounterSampled(name string, value int, rate float64) error {
+	if c.disabled.Load() {
+		return nil
+	}
+	if rate >= 1 {
+		return c.Counter(name, value)
+	}
+	if !c.sample(rate) {
+		return nil
+	}
+	name, err := c.metricName("counter", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	message := c.buildMessage("counter", &statMessage[int]{Name: name, Value: value, SampleRate: rate},
+		options{timestamp: c.clock.Now()})
+	return c.send(message)
+}
+
+// GaugeSampled is the same as Gauge, but only sends the message with probability rate (between 0.0 and 1.0).
+// Sent messages include a "sample_rate" field. With a rate of 1.0 or more this is identical to Gauge.
+func (c *Client) GaugeSampled(name string, value float64, rate float64) error {
+	if c.disabled.Load() {
+		return nil
+	}
+	if rate >= 1 {
+		return c.Gauge(name, value)
+	}
+	if !c.sample(rate) {
+		return nil
+	}
+	name, err := c.metricName("gauge", name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	message := c.buildMessage("gauge", &statMessage[float64]{Name: name, Value: value, SampleRate: rate},
+		options{timestamp: c.clock.Now()})
+	c.checkMonotonic(name, value, message)
+	return c.send(message)
+}
+
+// TimeSampled is the same as Time, but only times callback and reports its runtime with probability rate
+// (between 0.0 and 1.0). callback always runs. Sent gauges (or timers; see SetReportTimers) include a
+// "sample_rate" field. The clock isn't read at all for unsampled runs, so this costs little on hot paths. With a
+// rate of 1.0 or more this is identical to Time.
+func (c *Client) TimeSampled(callback func(), name string, rate float64) error {
+	if rate >= 1 {
+		return c.Time(callback, name)
+	}
+	if c.disabled.Load() || !c.sample(rate) {
+		callback()
+		return nil
+	}
+	start := c.clock.Now()
+	callback()
+	end := c.clock.Now()
+	messageType := "gauge"
+	if c.reportTimers.Load() {
+		messageType = "timer"
+	}
+	name, err := c.metricName(messageType, name)
+	if err != nil {
+		return ignoreDisabled(err)
+	}
+	value := end.Sub(start).Seconds()
+	message := c.buildMessage(messageType, &statMessage[float64]{Name: name, Value: value, SampleRate: rate},
+		options{timestamp: start})
+	if messageType == "gauge" {
+		c.checkMonotonic(name, value, message)
+	}
+	return c.send(message)
+}
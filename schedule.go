@@ -0,0 +1,137 @@
+package hastur
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule is returned by EveryAt for a schedule it can't parse.
+var ErrInvalidSchedule = errors.New("hastur: invalid schedule")
+
+// The longest EveryAt sleeps before checking the wall clock again, so that a change to the system clock delays
+// a run by at most this long.
+const maxScheduleWait = time.Minute
+
+// A schedule parsed from an EveryAt spec.
+type schedule struct {
+	// hour is -1 for an hourly schedule.
+	hour     int
+	minute   int
+	location *time.Location
+}
+
+// EveryAt runs callback at the wall-clock times given by schedule, which is one of
+//
+//	daily HH:MM     every day at the given hour and minute, for instance "daily 00:00"
+//	hourly :MM      every hour at the given minute, for instance "hourly :30"
+//
+// optionally followed by the name of a time zone, as in "daily 00:00 UTC". Times are in the local time zone
+// otherwise. Each run is scheduled by computing the next matching time from the wall clock, so reports stay
+// aligned across daylight saving changes and adjustments to the system clock. As with Every, runs are skipped
+// while the default client is disabled. Call Stop on the returned Stopper to halt the task. An error wrapping
+// ErrInvalidSchedule is returned if schedule can't be parsed.
+func EveryAt(schedule string, callback func()) (Stopper, error) {
+	s, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		next := s.next(time.Now())
+		timer := time.NewTimer(scheduleWait(next))
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				// Comparing with next, which has no monotonic clock reading, goes by the wall clock.
+				if time.Now().Before(next) {
+					timer.Reset(scheduleWait(next))
+					continue
+				}
+				if defaultClient.Enabled() {
+					callback()
+				}
+				// If the clock has been set back, start from the time just run so that it doesn't run twice.
+				after := time.Now()
+				if after.Before(next) {
+					after = next
+				}
+				next = s.next(after)
+				timer.Reset(scheduleWait(next))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cancelStopper(cancel), nil
+}
+
+func scheduleWait(next time.Time) time.Duration {
+	wait := time.Until(next)
+	if wait > maxScheduleWait {
+		return maxScheduleWait
+	}
+	return wait
+}
+
+func parseSchedule(spec string) (schedule, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidSchedule, spec)
+	fields := strings.Fields(spec)
+	if len(fields) != 2 && len(fields) != 3 {
+		return schedule{}, invalid
+	}
+	s := schedule{location: time.Local}
+	hour, minute, ok := strings.Cut(fields[1], ":")
+	if !ok {
+		return schedule{}, invalid
+	}
+	switch fields[0] {
+	case "daily":
+		h, err := strconv.Atoi(hour)
+		if err != nil || len(hour) != 2 || h < 0 || h > 23 {
+			return schedule{}, invalid
+		}
+		s.hour = h
+	case "hourly":
+		if hour != "" {
+			return schedule{}, invalid
+		}
+		s.hour = -1
+	default:
+		return schedule{}, invalid
+	}
+	m, err := strconv.Atoi(minute)
+	if err != nil || len(minute) != 2 || m < 0 || m > 59 {
+		return schedule{}, invalid
+	}
+	s.minute = m
+	if len(fields) == 3 {
+		location, err := time.LoadLocation(fields[2])
+		if err != nil {
+			return schedule{}, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, spec, err)
+		}
+		s.location = location
+	}
+	return s, nil
+}
+
+// Return the first time after after which matches the schedule. The candidates are built with time.Date from
+// the wall-clock fields, which accounts for daylight saving changes in between.
+func (s schedule) next(after time.Time) time.Time {
+	t := after.In(s.location)
+	for i := 0; ; i++ {
+		var candidate time.Time
+		if s.hour < 0 {
+			candidate = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+i, s.minute, 0, 0, s.location)
+		} else {
+			candidate = time.Date(t.Year(), t.Month(), t.Day()+i, s.hour, s.minute, 0, 0, s.location)
+		}
+		if candidate.After(after) {
+			return candidate
+		}
+	}
+}
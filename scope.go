@@ -0,0 +1,86 @@
+package hastur
+
+// Scope sends messages through a Client with a fixed set of labels added to each, for instrumenting a block of
+// code and everything it calls. Go has no goroutine-local storage, so the labels travel with the Scope value
+// itself rather than being added to the client's default labels, and never reach messages sent by other
+// goroutines through the client. Create one with WithScopedLabels. It is safe for concurrent use.
+type Scope struct {
+	client *Client
+	labels map[string]interface{}
+}
+
+// WithScopedLabels calls fn with a Scope which sends through c and adds labels to every message. Labels given
+// to an individual message take precedence over the scope's. The labels are copied, so later changes to the
+// map don't affect the scope.
+func (c *Client) WithScopedLabels(labels map[string]interface{}, fn func(scope *Scope)) {
+	fn(&Scope{client: c, labels: copyMap(labels)})
+}
+
+// WithScopedLabels calls fn with a Scope nested in s, whose messages carry both sets of labels. Where they
+// share a key, labels takes precedence.
+func (s *Scope) WithScopedLabels(labels map[string]interface{}, fn func(scope *Scope)) {
+	combined := copyMap(s.labels)
+	for key, value := range labels {
+		combined[key] = value
+	}
+	fn(&Scope{client: s.client, labels: combined})
+}
+
+// Client returns the client the scope sends through.
+func (s *Scope) Client() *Client { return s.client }
+
+// Prepend to opts an option adding the scope's labels.
+func (s *Scope) withLabels(opts []Option) []Option {
+	return append([]Option{WithLabels(s.labels)}, opts...)
+}
+
+// Mark is the same as Client.Mark but adds the scope's labels.
+func (s *Scope) Mark(name, value string, opts ...Option) error {
+	return s.client.Mark(name, value, s.withLabels(opts)...)
+}
+
+// Counter is the same as Client.Counter but adds the scope's labels.
+func (s *Scope) Counter(name string, value int, opts ...Option) error {
+	return s.client.Counter(name, value, s.withLabels(opts)...)
+}
+
+// CounterFloat is the same as Client.CounterFloat but adds the scope's labels.
+func (s *Scope) CounterFloat(name string, value float64, opts ...Option) error {
+	return s.client.CounterFloat(name, value, s.withLabels(opts)...)
+}
+
+// Gauge is the same as Client.Gauge but adds the scope's labels.
+func (s *Scope) Gauge(name string, value float64, opts ...Option) error {
+	return s.client.Gauge(name, value, s.withLabels(opts)...)
+}
+
+// GaugeInt is the same as Client.GaugeInt but adds the scope's labels.
+func (s *Scope) GaugeInt(name string, value int, opts ...Option) error {
+	return s.client.GaugeInt(name, value, s.withLabels(opts)...)
+}
+
+// Timer is the same as Client.Timer but adds the scope's labels.
+func (s *Scope) Timer(name string, value float64, opts ...Option) error {
+	return s.client.Timer(name, value, s.withLabels(opts)...)
+}
+
+// Set is the same as Client.Set but adds the scope's labels.
+func (s *Scope) Set(name, value string, opts ...Option) error {
+	return s.client.Set(name, value, s.withLabels(opts)...)
+}
+
+// Event is the same as Client.Event but adds the scope's labels.
+func (s *Scope) Event(name, subject, body string, attn []string, opts ...Option) error {
+	return s.client.Event(name, subject, body, attn, s.withLabels(opts)...)
+}
+
+// Log is the same as Client.Log but adds the scope's labels.
+func (s *Scope) Log(subject string, data interface{}, opts ...Option) error {
+	return s.client.Log(subject, data, s.withLabels(opts)...)
+}
+
+// WithScopedLabels calls fn with a Scope which sends through the default client and adds labels to every
+// message. See Client.WithScopedLabels.
+func WithScopedLabels(labels map[string]interface{}, fn func(scope *Scope)) {
+	defaultClient.WithScopedLabels(labels, fn)
+}
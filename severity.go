@@ -0,0 +1,59 @@
+package hastur
+
+// Severity is the importance of a log line sent with LogLevel.
+type Severity int
+
+const (
+	Debug Severity = iota
+	Info
+	Warn
+	Error
+	Fatal
+	numSeverities
+)
+
+var severityNames = [numSeverities]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+	Fatal: "fatal",
+}
+
+// String returns the lowercase name of the severity, such as "warn".
+func (s Severity) String() string {
+	if s < 0 || s >= numSeverities {
+		return "unknown"
+	}
+	return severityNames[s]
+}
+
+// LogLevel is the same as Log but also records the severity of the line, both in the data under "severity"
+// and as a "severity" label so that lines can be filtered by it. When data is a map[string]interface{}, the
+// severity is added to a copy of it; any other non-nil data is sent under "data" alongside the severity.
+func (c *Client) LogLevel(level Severity, subject string, data interface{}, opts ...Option) error {
+	o := c.applyOptions(opts)
+	o.setLabel("severity", level.String())
+	return c.log(subject, withSeverity(level, data), o)
+}
+
+// Return log data which includes the severity, without modifying data.
+func withSeverity(level Severity, data interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	switch data := data.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, value := range data {
+			fields[key] = value
+		}
+	default:
+		fields["data"] = data
+	}
+	fields["severity"] = level.String()
+	return fields
+}
+
+// LogLevel sends a log line with the given severity using the default client. See Client.LogLevel.
+func LogLevel(level Severity, subject string, data interface{}, opts ...Option) {
+	defaultClient.LogLevel(level, subject, data, opts...)
+}
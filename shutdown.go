@@ -0,0 +1,76 @@
+package hastur
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDrainTimeout is returned by DrainAndClose when the send queue is not empty by the deadline.
+var ErrDrainTimeout = errors.New("hastur: timed out draining the send queue")
+
+// Shutdown sends a final "process_stopping" mark, waits for any queued messages to be written, and closes the
+// client. If ctx is done before the queue drains, Shutdown returns ctx.Err() and leaves the client open.
+// Calling Shutdown on a closed client does nothing.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.connMutex.RLock()
+	closed := c.closed
+	c.connMutex.RUnlock()
+	if closed {
+		return nil
+	}
+	c.Mark("process_stopping", "")
+	flushed := make(chan struct{})
+	go func() {
+		c.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.Close()
+}
+
+// Shutdown stops the heartbeat begun by Start and shuts down the default client (see Client.Shutdown).
+// Applications should call it on their way out, for instance after receiving SIGTERM, so that the last
+// messages aren't lost. It is safe to call more than once.
+func Shutdown(ctx context.Context) error {
+	StopHeartbeat()
+	return defaultClient.Shutdown(ctx)
+}
+
+// DrainAndClose stops accepting messages, waits up to timeout for the asynchronous send queue to be written
+// out, and closes the client. Messages sent meanwhile are discarded and return ErrClosed. If the queue hasn't
+// drained when timeout elapses, DrainAndClose returns an error wrapping ErrDrainTimeout; the client goes on
+// writing the remaining messages in the background and closes once they are done. Unlike Shutdown, it sends no
+// "process_stopping" mark.
+func (c *Client) DrainAndClose(timeout time.Duration) error {
+	c.draining.Store(true)
+	closed := make(chan error, 1)
+	go func() {
+		c.Flush()
+		err := c.Close()
+		c.draining.Store(false)
+		closed <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-closed:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w (%d messages still queued)", ErrDrainTimeout, c.Snapshot().QueueDepth)
+	}
+}
+
+// DrainAndClose stops the heartbeat begun by Start and drains and closes the default client (see
+// Client.DrainAndClose). It is meant to be deferred in main:
+//
+//	defer hastur.DrainAndClose(5 * time.Second)
+func DrainAndClose(timeout time.Duration) error {
+	StopHeartbeat()
+	return defaultClient.DrainAndClose(timeout)
+}
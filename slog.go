@@ -0,0 +1,150 @@
+package hastur
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+// A slog.Handler which sends each record as a log message.
+type slogHandler struct {
+	client *Client
+	opts   slog.HandlerOptions
+	// data holds the attributes added with WithAttrs, nested under their groups.
+	data   map[string]interface{}
+	groups []string
+}
+
+// NewSlogHandler returns a slog.Handler which sends each record to Hastur as a log message, as though by
+// LogLevel. The record's message becomes the subject, its attributes become the data, and its level is mapped
+// to the nearest Severity at or below it (levels of slog.LevelError and above are Error). Groups become nested
+// maps in the data. Of opts, which may be nil, Level, AddSource (which adds "source" as "file:line"), and
+// ReplaceAttr are honored.
+func (c *Client) NewSlogHandler(opts *slog.HandlerOptions) slog.Handler {
+	h := &slogHandler{client: c, data: map[string]interface{}{}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minimum := slog.LevelInfo
+	if h.opts.Level != nil {
+		minimum = h.opts.Level.Level()
+	}
+	return level >= minimum && h.client.Enabled()
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs()+1)
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		attrs = append(attrs, slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", frame.File, frame.Line)))
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	opts := []Option{}
+	if !r.Time.IsZero() {
+		opts = append(opts, WithTimestamp(r.Time))
+	}
+	return h.client.LogLevel(slogSeverity(r.Level), r.Message, h.withAttrs(attrs), opts...)
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.data = h.withAttrs(attrs)
+	return &clone
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &clone
+}
+
+// Return a copy of the handler's data with attrs added under the current group. Groups left empty are omitted.
+func (h *slogHandler) withAttrs(attrs []slog.Attr) map[string]interface{} {
+	return h.addUnder(h.data, h.groups, attrs)
+}
+
+// Return a copy of data with attrs added to the group at path. Only the maps along path are copied; the rest
+// are shared, since they are never modified once built.
+func (h *slogHandler) addUnder(data map[string]interface{}, path []string, attrs []slog.Attr) map[string]interface{} {
+	result := copyMap(data)
+	if len(path) == 0 {
+		h.addAttrs(result, h.groups, attrs)
+		return result
+	}
+	inner, _ := data[path[0]].(map[string]interface{})
+	if inner = h.addUnder(inner, path[1:], attrs); len(inner) > 0 {
+		result[path[0]] = inner
+	}
+	return result
+}
+
+// Add attrs to data, resolving values, applying ReplaceAttr, and expanding groups.
+func (h *slogHandler) addAttrs(data map[string]interface{}, groups []string, attrs []slog.Attr) {
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if h.opts.ReplaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
+			attr = h.opts.ReplaceAttr(groups, attr)
+			attr.Value = attr.Value.Resolve()
+		}
+		switch {
+		case attr.Value.Kind() != slog.KindGroup:
+			if attr.Key != "" {
+				data[attr.Key] = slogValue(attr.Value)
+			}
+		case attr.Key == "":
+			h.addAttrs(data, groups, attr.Value.Group())
+		default:
+			group := map[string]interface{}{}
+			h.addAttrs(group, append(groups[:len(groups):len(groups)], attr.Key), attr.Value.Group())
+			if len(group) > 0 {
+				data[attr.Key] = group
+			}
+		}
+	}
+}
+
+// Convert a resolved, non-group slog value to one which encodes sensibly.
+func slogValue(value slog.Value) interface{} {
+	switch value.Kind() {
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	return value.Any()
+}
+
+// Map a slog level to the nearest Severity at or below it.
+func slogSeverity(level slog.Level) Severity {
+	switch {
+	case level < slog.LevelInfo:
+		return Debug
+	case level < slog.LevelWarn:
+		return Info
+	case level < slog.LevelError:
+		return Warn
+	}
+	return Error
+}
+
+// NewSlogHandler returns a slog.Handler which sends records as log messages using the default client. See
+// Client.NewSlogHandler.
+func NewSlogHandler(opts *slog.HandlerOptions) slog.Handler {
+	return defaultClient.NewSlogHandler(opts)
+}
@@ -0,0 +1,90 @@
+package hastur
+
+import (
+	"context"
+)
+
+// Stats describes what a client has done since it was created, for observing the client itself.
+type Stats struct {
+	// Sent is the number of messages written to the connection (or transport).
+	Sent uint64
+	// BytesWritten is the number of bytes in the sent messages, after compression and framing.
+	BytesWritten uint64
+	// Dropped is the number of messages dropped, keyed by reason, as returned by DroppedMessagesByReason.
+	Dropped map[DropReason]uint64
+	// Reconnects is the number of times the connection was re-dialed after a write failed.
+	Reconnects uint64
+	// SkippedTicks is the number of periodic runs (see Every) skipped because the previous run was still going.
+	SkippedTicks uint64
+	// EventRetries is the number of times an event was resent for lack of an acknowledgement (see
+	// SetEventRetry), and EventGiveUps the number of events never acknowledged after every attempt.
+	EventRetries uint64
+	EventGiveUps uint64
+	// QueueDepth is the number of messages waiting on the asynchronous send queue.
+	QueueDepth int
+	// LastError is the most recent error from sending a message, or nil if there has been none.
+	LastError error
+}
+
+// Snapshot returns the client's current Stats.
+func (c *Client) Snapshot() Stats {
+	stats := Stats{
+		Sent:         c.sent.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		Dropped:      c.DroppedMessagesByReason(),
+		Reconnects:   c.reconnects.Load(),
+		SkippedTicks: c.skippedTicks.Load(),
+		EventRetries: c.eventRetries.Load(),
+		EventGiveUps: c.eventGiveUps.Load(),
+	}
+	c.asyncMutex.RLock()
+	stats.QueueDepth = len(c.queue)
+	c.asyncMutex.RUnlock()
+	if err := c.lastError.Load(); err != nil {
+		stats.LastError = *err
+	}
+	return stats
+}
+
+// Record a message of the given size as written.
+func (c *Client) recordSent(size int) {
+	c.sent.Add(1)
+	c.bytesWritten.Add(uint64(size))
+}
+
+// StartSelfMetrics reports the client's own Stats as gauges at the given interval, so that problems with
+// sending show up in Hastur itself: "hastur.client.sent", "hastur.client.bytes_written",
+// "hastur.client.dropped" (for every reason), "hastur.client.reconnects", "hastur.client.skipped_ticks", and
+// "hastur.client.queue_depth".
+// The counts are totals since the client was created. Call Stop on the returned Stopper to halt reporting.
+func (c *Client) StartSelfMetrics(interval Interval) Stopper {
+	duration := funcInterval("StartSelfMetrics", interval)
+	return every(context.Background(), c, duration, false, func() { c.reportSelfMetrics() })
+}
+
+// Report the current Stats as gauges.
+func (c *Client) reportSelfMetrics() error {
+	stats := c.Snapshot()
+	var dropped uint64
+	for _, count := range stats.Dropped {
+		dropped += count
+	}
+	return sendBatch(c, "gauge", map[string]float64{
+		"hastur.client.sent":          float64(stats.Sent),
+		"hastur.client.bytes_written": float64(stats.BytesWritten),
+		"hastur.client.dropped":       float64(dropped),
+		"hastur.client.reconnects":    float64(stats.Reconnects),
+		"hastur.client.skipped_ticks": float64(stats.SkippedTicks),
+		"hastur.client.queue_depth":   float64(stats.QueueDepth),
+	}, c.internalOptions())
+}
+
+// Snapshot returns the default client's current Stats.
+func Snapshot() Stats {
+	return defaultClient.Snapshot()
+}
+
+// StartSelfMetrics reports the default client's own Stats as gauges. See Client.StartSelfMetrics.
+func StartSelfMetrics(interval Interval) Stopper {
+	return defaultClient.StartSelfMetrics(interval)
+}
@@ -0,0 +1,37 @@
+package hastur
+
+// Status is a health status sent as the value of a mark by StatusMark.
+type Status int
+
+const (
+	Green Status = iota
+	Yellow
+	Red
+	numStatuses
+)
+
+// The mark values for each status, as the backend expects them.
+var statusNames = [numStatuses]string{
+	Green:  "Green",
+	Yellow: "Yellow",
+	Red:    "Red",
+}
+
+// String returns the mark value for the status, such as "Yellow".
+func (s Status) String() string {
+	if s < 0 || s >= numStatuses {
+		return "Unknown"
+	}
+	return statusNames[s]
+}
+
+// StatusMark sends a mark whose value is the given status ("Green", "Yellow", or "Red"). Using a Status
+// rather than a string rules out misspelled values.
+func (c *Client) StatusMark(name string, status Status, opts ...Option) error {
+	return c.Mark(name, status.String(), opts...)
+}
+
+// StatusMark sends a status mark using the default client. See Client.StatusMark.
+func StatusMark(name string, status Status, opts ...Option) {
+	defaultClient.StatusMark(name, status, opts...)
+}
@@ -0,0 +1,73 @@
+package hastur
+
+import (
+	"encoding/json"
+)
+
+// SubscriberBuffer is the number of messages each channel returned by Subscribe holds before further messages
+// are discarded for that subscriber.
+const SubscriberBuffer = 1024
+
+// Subscribe returns a channel which receives a copy of every message the client sends, as the map its JSON
+// form decodes to (so numbers are float64), such as {"type": "counter", "name": "requests", "value": 1, ...}.
+// This lets messages be inspected or forwarded to another system without decoding them from the network.
+// Messages are delivered as they are sent, before being queued or written, and are delivered even in dry-run
+// mode; messages which are rate-limited, or sent while the client is disabled, are not. Each call returns a
+// new channel which receives every message. Sending never waits on a subscriber: if a channel's buffer (see
+// SubscriberBuffer) is full, messages are discarded for that subscriber until it catches up. Call Unsubscribe
+// when done with the channel.
+func (c *Client) Subscribe() <-chan map[string]interface{} {
+	ch := make(chan map[string]interface{}, SubscriberBuffer)
+	c.subscribersMutex.Lock()
+	defer c.subscribersMutex.Unlock()
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops delivering messages to a channel returned by Subscribe and closes it. Unknown channels are
+// ignored.
+func (c *Client) Unsubscribe(ch <-chan map[string]interface{}) {
+	c.subscribersMutex.Lock()
+	defer c.subscribersMutex.Unlock()
+	for i, subscriber := range c.subscribers {
+		if subscriber == ch {
+			c.subscribers = append(c.subscribers[:i:i], c.subscribers[i+1:]...)
+			close(subscriber)
+			return
+		}
+	}
+}
+
+// Deliver a copy of message to each subscriber.
+func (c *Client) publish(message interface{}) {
+	c.subscribersMutex.RLock()
+	defer c.subscribersMutex.RUnlock()
+	if len(c.subscribers) == 0 {
+		return
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	for _, subscriber := range c.subscribers {
+		var decoded map[string]interface{}
+		if json.Unmarshal(encoded, &decoded) != nil {
+			return
+		}
+		select {
+		case subscriber <- decoded:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel which receives a copy of every message the default client sends. See
+// Client.Subscribe.
+func Subscribe() <-chan map[string]interface{} {
+	return defaultClient.Subscribe()
+}
+
+// Unsubscribe stops delivering the default client's messages to a channel returned by Subscribe.
+func Unsubscribe(ch <-chan map[string]interface{}) {
+	defaultClient.Unsubscribe(ch)
+}
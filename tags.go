@@ -0,0 +1,76 @@
+package hastur
+
+// Tags are a second set of key/value pairs attached to messages, sent under "tags" rather than "labels". The
+// backend indexes tags, so they should be kept to low-cardinality values (such as a region or service tier),
+// while high-cardinality values (such as a request ID) belong in labels. Messages without tags omit the field.
+
+// AddDefaultTags adds tag key/value pairs to the set of default tags to attach to every message. As with
+// labels, tags of the same key given for a single message take precedence over these.
+func (c *Client) AddDefaultTags(tags map[string]interface{}) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	defaults := copyMap(c.defaultTags)
+	for tag, value := range tags {
+		defaults[tag] = value
+	}
+	c.defaultTags = defaults
+}
+
+// RemoveDefaultTags removes default tags, given by key, that were previously added using AddDefaultTags.
+func (c *Client) RemoveDefaultTags(tags ...string) {
+	c.labelsMutex.Lock()
+	defer c.labelsMutex.Unlock()
+	defaults := copyMap(c.defaultTags)
+	for _, tag := range tags {
+		delete(defaults, tag)
+	}
+	c.defaultTags = defaults
+}
+
+// DefaultTags returns the current default tags. The returned map is a copy and may be freely modified by the
+// caller.
+func (c *Client) DefaultTags() map[string]interface{} {
+	return copyMap(c.currentDefaultTags())
+}
+
+// Return the default tags, which must not be modified.
+func (c *Client) currentDefaultTags() map[string]interface{} {
+	c.labelsMutex.RLock()
+	defer c.labelsMutex.RUnlock()
+	return c.defaultTags
+}
+
+// Merge some extra tags with the default tags, returning nil if there are none. The result must not be
+// modified, since it is the shared map of default tags when there are no extra tags.
+func (c *Client) mergeDefaultTags(tags map[string]interface{}) map[string]interface{} {
+	defaults := c.currentDefaultTags()
+	if len(tags) == 0 {
+		if len(defaults) == 0 {
+			return nil
+		}
+		return defaults
+	}
+	result := make(map[string]interface{}, len(tags)+len(defaults))
+	for tag, value := range defaults {
+		result[tag] = value
+	}
+	for tag, value := range tags {
+		result[tag] = value
+	}
+	return result
+}
+
+// AddDefaultTags adds tags to the default client's default tags. See Client.AddDefaultTags.
+func AddDefaultTags(tags map[string]interface{}) {
+	defaultClient.AddDefaultTags(tags)
+}
+
+// RemoveDefaultTags removes tags from the default client's default tags.
+func RemoveDefaultTags(tags ...string) {
+	defaultClient.RemoveDefaultTags(tags...)
+}
+
+// DefaultTags returns the default client's default tags.
+func DefaultTags() map[string]interface{} {
+	return defaultClient.DefaultTags()
+}
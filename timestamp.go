@@ -0,0 +1,45 @@
+package hastur
+
+import (
+	"time"
+)
+
+// TimestampResolution specifies the unit of the timestamps in messages (see SetTimestampResolution).
+type TimestampResolution int
+
+const (
+	// Microsecond sends timestamps as microseconds since the epoch, Hastur's usual format. This is the default.
+	Microsecond TimestampResolution = iota
+	// Nanosecond sends timestamps as nanoseconds since the epoch.
+	Nanosecond
+)
+
+// SetTimestampResolution sets the unit of message timestamps, and of the "start_time" of process
+// registrations. Messages carry no indication of the unit, so the agent must be configured to expect the same
+// unit.
+func (c *Client) SetTimestampResolution(resolution TimestampResolution) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.resolution = resolution
+}
+
+// TimestampResolution returns the unit of message timestamps.
+func (c *Client) TimestampResolution() TimestampResolution {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	return c.resolution
+}
+
+// Convert t to Hastur's time format, a count of microseconds (or nanoseconds) since the epoch.
+func convertTime(t time.Time, resolution TimestampResolution) int64 {
+	if resolution == Nanosecond {
+		return t.UnixNano()
+	}
+	return t.UnixNano() / 1000
+}
+
+// SetTimestampResolution sets the unit of the default client's message timestamps. See
+// Client.SetTimestampResolution.
+func SetTimestampResolution(resolution TimestampResolution) {
+	defaultClient.SetTimestampResolution(resolution)
+}
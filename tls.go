@@ -0,0 +1,32 @@
+package hastur
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// SetTLSConfig makes the client connect over TLS, using config, whenever its network is TCP (see SetNetwork),
+// for sending to a remote agent across an untrusted network. The agent's certificate is verified against
+// config.RootCAs (or the system's pool, if that is nil) and config.ServerName, which defaults to the address
+// being dialed. Additional destinations are dialed over TLS too. UDP and Unix socket connections are
+// unaffected. A nil config, the default, goes back to plain connections.
+//
+// If the client is already using TCP, it reconnects with the new settings, and an error is returned if that
+// fails; the dial is then retried on later sends, as usual.
+func (c *Client) SetTLSConfig(config *tls.Config) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.tlsConfig = nil
+	if config != nil {
+		c.tlsConfig = config.Clone()
+	}
+	if !strings.HasPrefix(c.network, "tcp") || c.externalConn {
+		return nil
+	}
+	return c.establishConn()
+}
+
+// SetTLSConfig makes the default client connect over TLS when using TCP. See Client.SetTLSConfig.
+func SetTLSConfig(config *tls.Config) error {
+	return defaultClient.SetTLSConfig(config)
+}
@@ -0,0 +1,62 @@
+package hastur
+
+import (
+	"sync"
+)
+
+// Transport delivers encoded messages in place of the client's connection. It is mainly useful for testing code
+// which emits Hastur messages without standing up a listener; see MemoryTransport.
+type Transport interface {
+	Send(message []byte) error
+}
+
+// NewClientWithTransport creates a Client which sends every message through transport, without dialing the
+// agent. See SetTransport.
+func NewClientWithTransport(transport Transport) *Client {
+	c := newUnconnectedClient("udp", defaultUdpAddress, defaultUdpPort)
+	c.SetTransport(transport)
+	return c
+}
+
+// SetTransport routes messages through transport instead of the client's connection. Messages are passed to
+// the transport after encoding and compression, without the newline framing used by stream networks, and a
+// failed Send is counted as a dropped message (DropWriteError). Additional destinations still receive a copy.
+// A nil transport restores the connection.
+func (c *Client) SetTransport(transport Transport) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.transport = transport
+}
+
+// MemoryTransport is a Transport which records every message sent through it. It is safe for concurrent use,
+// and the zero value is ready to use:
+//
+//	transport := &hastur.MemoryTransport{}
+//	hastur.SetTransport(transport)
+//	defer hastur.SetTransport(nil)
+type MemoryTransport struct {
+	mutex    sync.Mutex
+	messages [][]byte
+}
+
+// Send records a copy of message.
+func (t *MemoryTransport) Send(message []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = append(t.messages, append([]byte(nil), message...))
+	return nil
+}
+
+// Messages returns the messages recorded so far, oldest first.
+func (t *MemoryTransport) Messages() [][]byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([][]byte(nil), t.messages...)
+}
+
+// Reset discards the recorded messages.
+func (t *MemoryTransport) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = nil
+}
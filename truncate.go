@@ -0,0 +1,59 @@
+package hastur
+
+import (
+	"unicode/utf8"
+)
+
+// Default limits, in bytes, on the text fields of events and logs. Longer text is truncated.
+const (
+	DefaultMaxEventSubjectLen = 3072
+	DefaultMaxEventBodyLen    = 3072
+	DefaultMaxLogSubjectLen   = 7168
+)
+
+// SetMaxEventSubjectLen sets the length, in bytes, beyond which event subjects are truncated.
+// A negative length is treated as zero.
+func (c *Client) SetMaxEventSubjectLen(max int) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	c.maxEventSubjectLen = max
+}
+
+// SetMaxEventBodyLen sets the length, in bytes, beyond which event bodies are truncated.
+// A negative length is treated as zero.
+func (c *Client) SetMaxEventBodyLen(max int) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	c.maxEventBodyLen = max
+}
+
+// SetMaxLogSubjectLen sets the length, in bytes, beyond which log subjects are truncated.
+// A negative length is treated as zero.
+func (c *Client) SetMaxLogSubjectLen(max int) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	c.maxLogSubjectLen = max
+}
+
+// Truncate s to at most max bytes without splitting a UTF-8 encoded rune. A max of zero or less gives "".
+func truncate(s string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}